@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminListSize is the number of recent posts and comments shown on the dashboard
+const adminListSize = 25
+
+// adminStats holds the site totals shown on the admin dashboard
+type adminStats struct {
+	Posts      int
+	Comments   int
+	PostsToday int
+}
+
+// loadAdminStats counts all posts, all comments and the posts created since midnight UTC
+func loadAdminStats(ctx context.Context, db *sql.DB) (adminStats, error) {
+	var stats adminStats
+	err := db.QueryRowContext(ctx, dialectQuery(db, `
+        SELECT
+            (SELECT COUNT(*) FROM posts WHERE deleted_at IS NULL),
+            (SELECT COUNT(*) FROM comments),
+            (SELECT COUNT(*) FROM posts WHERE deleted_at IS NULL AND created_at >= CURRENT_DATE)
+    `, `
+        SELECT
+            (SELECT COUNT(*) FROM posts WHERE deleted_at IS NULL),
+            (SELECT COUNT(*) FROM comments),
+            (SELECT COUNT(*) FROM posts WHERE deleted_at IS NULL AND created_at >= date('now'))
+    `)).Scan(&stats.Posts, &stats.Comments, &stats.PostsToday)
+	return stats, err
+}
+
+// errTooManyPinned is returned by setPostPinned when the limit of pinned posts is reached
+var errTooManyPinned = errors.New("too many pinned posts")
+
+// setPostPinned pins or unpins a live post
+// Pinning fails with errTooManyPinned once maxPinned other posts are pinned.
+// It returns sql.ErrNoRows if the post does not exist.
+func setPostPinned(ctx context.Context, db *sql.DB, id int, pinned bool, maxPinned int) error {
+	return withTx(ctx, db, func(tx *sql.Tx) error {
+		if pinned {
+			var count int
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE pinned AND deleted_at IS NULL AND id <> $1", id).Scan(&count); err != nil {
+				return err
+			}
+			if count >= maxPinned {
+				return errTooManyPinned
+			}
+		}
+		res, err := tx.ExecContext(ctx, "UPDATE posts SET pinned = $1 WHERE id = $2 AND deleted_at IS NULL", pinned, id)
+		if err != nil {
+			return err
+		}
+		return requireRowsAffected(res)
+	})
+}
+
+// requireAdmin is a middleware that only lets the listed users through
+// It must run after requireAuth, which turns away anonymous requests.
+func requireAdmin(admins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(admins))
+	for _, name := range admins {
+		allowed[name] = true
+	}
+	return func(c *gin.Context) {
+		if !allowed[currentUser(c).Username] {
+			if strings.HasPrefix(c.FullPath(), "/api/") {
+				abortJSON(c, http.StatusForbidden, errCodeForbidden, "Admin access required")
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// registerAdminRoutes registers the admin dashboard
+// Its delete buttons post to the regular delete routes and come back here.
+func registerAdminRoutes(r *gin.Engine, db *sql.DB, admins []string, maxPinned int) {
+	// Route to display site stats and the latest content with moderation actions
+	r.GET("/admin", requireAuth(), requireAdmin(admins), func(c *gin.Context) {
+		stats, err := loadAdminStats(c.Request.Context(), db)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		posts, err := listPosts(c.Request.Context(), db, postListOptions{Sort: sortNew, Limit: adminListSize})
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		comments, err := listRecentComments(c.Request.Context(), db, adminListSize, 0)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		deleted, err := listPosts(c.Request.Context(), db, postListOptions{Sort: sortNew, Deleted: true, Limit: adminListSize})
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		renderTemplate(c, "admin.html", map[string]interface{}{
+			"Stats":    stats,
+			"Posts":    posts,
+			"Comments": comments,
+			"Deleted":  deleted,
+		})
+	})
+
+	// Route to mark a comment dead, or live again
+	// Dead comments stay in their thread as a placeholder so replies keep their context.
+	r.POST("/admin/comment/:commentID/status", requireAuth(), requireAdmin(admins), func(c *gin.Context) {
+		commentID, err := strconv.Atoi(c.Param("commentID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+			return
+		}
+		status := c.PostForm("status")
+		if status != commentLive && status != commentDead {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be live or dead"})
+			return
+		}
+		if err := setCommentStatus(c.Request.Context(), db, commentID, status); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		c.Redirect(http.StatusFound, nextPath(c, "/admin"))
+	})
+
+	// Route to pin a post to the top of the front page, or unpin it with pinned=false
+	r.POST("/admin/post/:id/pin", requireAuth(), requireAdmin(admins), func(c *gin.Context) {
+		pinned, err := strconv.ParseBool(c.DefaultPostForm("pinned", "true"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Pinned must be true or false"})
+			return
+		}
+		if err := setPostPinned(c.Request.Context(), db, postIDParam(c), pinned, maxPinned); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			case errTooManyPinned:
+				c.JSON(http.StatusConflict, gin.H{"error": "At most " + strconv.Itoa(maxPinned) + " posts can be pinned, unpin one first"})
+			default:
+				serverError(c, err)
+			}
+			return
+		}
+		c.Redirect(http.StatusFound, nextPath(c, "/admin"))
+	})
+
+	// Route to bring back a soft-deleted post
+	r.POST("/admin/post/:id/restore", requireAuth(), requireAdmin(admins), func(c *gin.Context) {
+		if err := restorePost(c.Request.Context(), db, postIDParam(c)); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Deleted post not found"})
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		c.Redirect(http.StatusFound, "/admin")
+	})
+}
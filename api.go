@@ -0,0 +1,190 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newPostRequest is the JSON body accepted by POST /api/posts
+type newPostRequest struct {
+	Title   string   `json:"title" binding:"required"`
+	Link    string   `json:"link"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags"`
+	Author  string   `json:"author"`
+}
+
+// postPage is the envelope returned by GET /api/posts
+type postPage struct {
+	Data    []Post `json:"data"`
+	Page    int    `json:"page"`
+	PerPage int    `json:"per_page"`
+	Total   int    `json:"total"`
+	HasNext bool   `json:"has_next"`
+}
+
+const (
+	defaultCommentLimit = 50  // Comments returned by the API when no limit is given
+	maxCommentLimit     = 200 // Largest accepted comment limit
+)
+
+// registerAPIRoutes registers the JSON API routes under /api
+// Errors are reported through abortJSON so every failure has the same shape.
+func registerAPIRoutes(r *gin.Engine, db *sql.DB, cors gin.HandlerFunc, admins []string, maxCommentDepth, pointsFloor int) {
+	api := r.Group("/api", cors)
+
+	// Route to answer CORS preflight requests for any API path
+	// The cors middleware replies to allowed origins before this handler runs.
+	api.OPTIONS("/*path", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	// Route to list posts as JSON
+	// Paging follows the HTML listing: ?page and ?per_page are parsed and clamped by parsePageParams.
+	// ?sort picks the same orderings as the web UI: hot (the default), new or top.
+	// Unlike the HTML views, an unknown sort is rejected rather than ignored.
+	api.GET("/posts", func(c *gin.Context) {
+		sort := c.DefaultQuery("sort", defaultSort)
+		if !validSort(sort) {
+			abortJSON(c, http.StatusBadRequest, errCodeBadRequest, "sort must be one of hot, new or top")
+			return
+		}
+		page, perPage := parsePageParams(c)
+		opts := postListOptions{Sort: sort, Limit: perPage, Offset: (page - 1) * perPage}
+		total, err := countPosts(c.Request.Context(), db, opts)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		posts, err := listPosts(c.Request.Context(), db, opts)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		if posts == nil {
+			posts = []Post{}
+		}
+		c.JSON(http.StatusOK, postPage{
+			Data:    posts,
+			Page:    page,
+			PerPage: perPage,
+			Total:   total,
+			HasNext: page*perPage < total,
+		})
+	})
+
+	// Route to display a single post and its comments as JSON
+	api.GET("/posts/:id", func(c *gin.Context) {
+		post, err := getPostByID(c.Request.Context(), db, postIDParam(c))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				abortJSON(c, http.StatusNotFound, errCodeNotFound, "Post not found")
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+
+		post.Comments, err = listComments(c.Request.Context(), db, post.ID, parseCommentSort(c.Query("comments")))
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, post)
+	})
+
+	// Route to list a post's comments as a flat JSON array
+	// Replies reference their parent through parent_id. Results are paged with
+	// ?limit and ?offset and ordered with ?comments=old|new like the HTML view.
+	api.GET("/posts/:id/comments", func(c *gin.Context) {
+		post, err := getPostByID(c.Request.Context(), db, postIDParam(c))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				abortJSON(c, http.StatusNotFound, errCodeNotFound, "Post not found")
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit < 1 {
+			limit = defaultCommentLimit
+		}
+		if limit > maxCommentLimit {
+			limit = maxCommentLimit
+		}
+		offset, err := strconv.Atoi(c.Query("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		comments, err := listCommentsRange(c.Request.Context(), db, post.ID, parseCommentSort(c.Query("comments")), limit, offset)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		if comments == nil {
+			comments = []Comment{}
+		}
+		c.JSON(http.StatusOK, comments)
+	})
+
+	// Route to add a new post from a JSON body
+	// Like the form, a link that was already submitted upvotes the existing post,
+	// which is returned with 200 instead of 201.
+	api.POST("/posts", requireAuth(), func(c *gin.Context) {
+		var req newPostRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortJSON(c, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
+		req.Title = strings.TrimSpace(req.Title)
+		link, tags, errs := checkSubmission(req.Title, req.Link, req.Content, strings.Join(req.Tags, ","))
+		if errs != nil {
+			abortJSON(c, http.StatusBadRequest, errCodeBadRequest, errs[0].Message)
+			return
+		}
+		id, created, err := submitPost(c.Request.Context(), db, req.Title, req.Content, link, tags, currentUserID(c), authorName(c, req.Author), voterKey(c), pointsFloor, nil)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		post, err := getPostByID(c.Request.Context(), db, id)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		status := http.StatusCreated
+		if !created {
+			status = http.StatusOK
+		}
+		c.JSON(status, post)
+	})
+
+	// Route to import posts and their nested comments from a JSON array, for seeding demo sites
+	// Every record is validated before anything is written, and the inserts run
+	// in one transaction, so a failed import leaves no trace.
+	api.POST("/import", requireAuth(), requireAdmin(admins), func(c *gin.Context) {
+		var posts []importPost
+		if err := c.ShouldBindJSON(&posts); err != nil {
+			abortJSON(c, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
+		if err := prepareImport(posts, maxCommentDepth); err != nil {
+			abortJSON(c, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
+		summary, err := importPosts(c.Request.Context(), db, posts)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, summary)
+	})
+}
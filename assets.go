@@ -0,0 +1,66 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// embeddedAssets holds the templates and static files compiled into the binary
+//
+//go:embed templates/* static/*
+var embeddedAssets embed.FS
+
+// devTemplates is set in dev mode so templates are re-read on every render
+var devTemplates fs.FS
+
+// assetFS returns the file system templates and static files are served from
+// In dev mode they are read from the working directory so edits show up without a rebuild.
+func assetFS(dev bool) fs.FS {
+	if dev {
+		return os.DirFS(".")
+	}
+	return embeddedAssets
+}
+
+// templates holds the parsed HTML templates keyed by file name
+var templates map[string]*template.Template
+
+// parseTemplates parses every HTML template in the templates directory of fsys once
+// Each template is stored under its file name, e.g. "index.html".
+func parseTemplates(fsys fs.FS) (map[string]*template.Template, error) {
+	paths, err := fs.Glob(fsys, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	parsed := make(map[string]*template.Template, len(paths))
+	for _, p := range paths {
+		tmpl, err := parseTemplate(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		parsed[path.Base(p)] = tmpl
+	}
+	return parsed, nil
+}
+
+// parseTemplate parses a single template file with the shared template functions
+func parseTemplate(fsys fs.FS, p string) (*template.Template, error) {
+	return template.New(path.Base(p)).Funcs(templateFuncs).ParseFS(fsys, p)
+}
+
+// lookupTemplate returns the named template
+// In dev mode the file is parsed again so template edits apply on the next request.
+func lookupTemplate(name string) (*template.Template, error) {
+	if devTemplates != nil {
+		return parseTemplate(devTemplates, path.Join("templates", name))
+	}
+	tmpl, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User represents a registered account
+type User struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	Karma        int       `json:"karma"` // Points across the user's live posts
+	Email        string    `json:"-"`     // Optional address for reply notifications
+}
+
+const (
+	// sessionCookie is the name of the cookie holding the session token
+	sessionCookie = "session"
+	// sessionTTL is how long a login session stays valid
+	sessionTTL = 30 * 24 * time.Hour
+	// userContextKey is the Gin context key holding the logged-in *User
+	userContextKey = "user"
+	// minPasswordLength is the shortest password accepted at registration
+	minPasswordLength = 8
+)
+
+// usernamePattern restricts usernames to 3-32 letters, digits, underscores and dashes
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+// errUsernameTaken is returned by createUser when the username already exists
+var errUsernameTaken = errors.New("username is already taken")
+
+// createUser hashes the password and inserts a new user with an optional email address
+// It returns errUsernameTaken if the username already exists.
+func createUser(ctx context.Context, db *sql.DB, username, password, email string) (*User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := &User{Username: username, PasswordHash: string(hash), Email: email}
+	err = db.QueryRowContext(ctx, `
+        INSERT INTO users (username, password_hash, email, created_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+        ON CONFLICT (username) DO NOTHING
+        RETURNING id, created_at
+    `, username, user.PasswordHash, email).Scan(&user.ID, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errUsernameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// getUserByUsername returns a user by username
+// It returns sql.ErrNoRows if the user does not exist.
+func getUserByUsername(ctx context.Context, db *sql.DB, username string) (*User, error) {
+	var user User
+	err := db.QueryRowContext(ctx, "SELECT id, username, password_hash, created_at, karma FROM users WHERE username = $1", username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.Karma,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// createSession stores a new session for the user and returns its random token
+func createSession(ctx context.Context, db *sql.DB, userID int) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if _, err := db.ExecContext(ctx, "INSERT INTO sessions (token, user_id, created_at, expires_at) VALUES ($1, $2, CURRENT_TIMESTAMP, $3)",
+		token, userID, time.Now().Add(sessionTTL)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// getSessionUser returns the user owning an unexpired session token
+// It returns sql.ErrNoRows if the session does not exist or has expired.
+func getSessionUser(ctx context.Context, db *sql.DB, token string) (*User, error) {
+	var user User
+	err := db.QueryRowContext(ctx, `
+        SELECT u.id, u.username, u.password_hash, u.created_at, u.karma
+        FROM sessions s
+        JOIN users u ON u.id = s.user_id
+        WHERE s.token = $1 AND s.expires_at > $2
+    `, token, time.Now()).Scan(
+		&user.ID,
+		&user.Username,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.Karma,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// startSession creates a session for the user and sets the session cookie
+func startSession(c *gin.Context, db *sql.DB, userID int) error {
+	token, err := createSession(c.Request.Context(), db, userID)
+	if err != nil {
+		return err
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, token, int(sessionTTL/time.Second), "/", "", isHTTPS(c), true)
+	rotateCSRFToken(c)
+	return nil
+}
+
+// loadUser is a middleware that loads the logged-in user from the session cookie
+// Requests without a valid session proceed anonymously.
+func loadUser(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(sessionCookie)
+		if err == nil && token != "" {
+			user, err := getSessionUser(c.Request.Context(), db, token)
+			if err == nil {
+				c.Set(userContextKey, user)
+			} else if err != sql.ErrNoRows {
+				serverError(c, err)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// requireAuth is a middleware that rejects anonymous requests
+// Browser routes are redirected to the login page, while API routes get a 401.
+func requireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if currentUser(c) != nil {
+			c.Next()
+			return
+		}
+		if strings.HasPrefix(c.FullPath(), "/api/") {
+			abortJSON(c, http.StatusUnauthorized, errCodeUnauthorized, "Login required")
+			return
+		}
+		c.Redirect(http.StatusFound, "/login")
+		c.Abort()
+	}
+}
+
+// currentUser returns the logged-in user, or nil for anonymous requests
+func currentUser(c *gin.Context) *User {
+	if v, ok := c.Get(userContextKey); ok {
+		if user, ok := v.(*User); ok {
+			return user
+		}
+	}
+	return nil
+}
+
+// currentUserID returns the logged-in user's ID, or nil for anonymous requests
+func currentUserID(c *gin.Context) *int {
+	if user := currentUser(c); user != nil {
+		return &user.ID
+	}
+	return nil
+}
+
+// isAdmin reports whether the logged-in user is one of the listed admins
+func isAdmin(c *gin.Context, admins []string) bool {
+	user := currentUser(c)
+	return user != nil && slices.Contains(admins, user.Username)
+}
+
+// canModify reports whether the logged-in user may edit or delete content by authorID
+// Only the author and admins may; content without an author, such as posts
+// from before accounts existed, is left to admins.
+func canModify(c *gin.Context, authorID *int, admins []string) bool {
+	if isAdmin(c, admins) {
+		return true
+	}
+	user := currentUser(c)
+	return user != nil && authorID != nil && *authorID == user.ID
+}
+
+// maxAuthorLength matches the VARCHAR(64) author columns of posts and comments
+const maxAuthorLength = 64
+
+// anonymousAuthor is the display name of submissions without a name or a logged-in user
+const anonymousAuthor = "anonymous"
+
+// authorName returns the display name to store with a submission
+// The submitted name is cleaned with cleanAuthor and defaults to the logged-in
+// user's name, or anonymousAuthor without one. A logged-in user who gives a
+// different name is shown with the username after it, as in "Jane (alice)", so
+// nobody can pass for another account.
+func authorName(c *gin.Context, submitted string) string {
+	name := cleanAuthor(submitted)
+	user := currentUser(c)
+	switch {
+	case user == nil && name == "":
+		return anonymousAuthor
+	case user == nil:
+		return name
+	case name == "" || name == user.Username:
+		return user.Username
+	}
+	suffix := " (" + user.Username + ")"
+	if runes := []rune(name); len(runes)+utf8.RuneCountInString(suffix) > maxAuthorLength {
+		name = strings.TrimSpace(string(runes[:maxAuthorLength-utf8.RuneCountInString(suffix)]))
+	}
+	return name + suffix
+}
+
+// cleanAuthor trims a submitted display name and cuts it to maxAuthorLength characters
+func cleanAuthor(submitted string) string {
+	runes := []rune(strings.TrimSpace(submitted))
+	if len(runes) > maxAuthorLength {
+		runes = runes[:maxAuthorLength]
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// registerAuthRoutes registers the registration, login and logout routes
+func registerAuthRoutes(r *gin.Engine, db *sql.DB) {
+	// Route to display the registration form
+	r.GET("/register", func(c *gin.Context) {
+		renderTemplate(c, "register.html", map[string]interface{}{})
+	})
+
+	// Route to create an account and log in
+	r.POST("/register", func(c *gin.Context) {
+		username := strings.TrimSpace(c.PostForm("username"))
+		password := c.PostForm("password")
+		email := strings.TrimSpace(c.PostForm("email"))
+		fail := func(msg string) {
+			c.Status(http.StatusBadRequest)
+			renderTemplate(c, "register.html", map[string]interface{}{
+				"Error":    msg,
+				"Username": username,
+				"Email":    email,
+			})
+		}
+		if !usernamePattern.MatchString(username) {
+			fail("Username must be 3-32 characters of letters, digits, underscores or dashes")
+			return
+		}
+		if len(password) < minPasswordLength {
+			fail("Password must be at least 8 characters")
+			return
+		}
+		if email != "" && !validEmail(email) {
+			fail("Email must be a plain address such as you@example.com")
+			return
+		}
+
+		user, err := createUser(c.Request.Context(), db, username, password, email)
+		if err == errUsernameTaken {
+			fail("That username is already taken")
+			return
+		}
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		if err := startSession(c, db, user.ID); err != nil {
+			serverError(c, err)
+			return
+		}
+		c.Redirect(http.StatusFound, "/")
+	})
+
+	// Route to display the login form
+	r.GET("/login", func(c *gin.Context) {
+		renderTemplate(c, "login.html", map[string]interface{}{})
+	})
+
+	// Route to check credentials and log in
+	r.POST("/login", func(c *gin.Context) {
+		username := strings.TrimSpace(c.PostForm("username"))
+		password := c.PostForm("password")
+
+		user, err := getUserByUsername(c.Request.Context(), db, username)
+		if err != nil && err != sql.ErrNoRows {
+			serverError(c, err)
+			return
+		}
+		if err == sql.ErrNoRows || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+			c.Status(http.StatusUnauthorized)
+			renderTemplate(c, "login.html", map[string]interface{}{
+				"Error":    "Invalid username or password",
+				"Username": username,
+			})
+			return
+		}
+		if err := startSession(c, db, user.ID); err != nil {
+			serverError(c, err)
+			return
+		}
+		c.Redirect(http.StatusFound, "/")
+	})
+
+	// Route to end the current session
+	r.POST("/logout", func(c *gin.Context) {
+		if token, err := c.Cookie(sessionCookie); err == nil {
+			if _, err := db.ExecContext(c.Request.Context(), "DELETE FROM sessions WHERE token = $1", token); err != nil {
+				serverError(c, err)
+				return
+			}
+		}
+		c.SetCookie(sessionCookie, "", -1, "/", "", isHTTPS(c), true)
+		rotateCSRFToken(c)
+		c.Redirect(http.StatusFound, "/")
+	})
+}
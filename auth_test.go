@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testRouter returns a router in test mode that signs every request in as user, if not nil
+func testRouter(user *User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if user != nil {
+		r.Use(func(c *gin.Context) { c.Set(userContextKey, user) })
+	}
+	return r
+}
+
+func TestRequireAuth(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         *User
+		path         string
+		wantStatus   int
+		wantLocation string
+		wantCode     string
+	}{
+		{"anonymous browser request", nil, "/new", http.StatusFound, "/login", ""},
+		{"anonymous API request", nil, "/api/posts", http.StatusUnauthorized, "", errCodeUnauthorized},
+		{"logged in browser request", &User{ID: 1, Username: "alice"}, "/new", http.StatusOK, "", ""},
+		{"logged in API request", &User{ID: 1, Username: "alice"}, "/api/posts", http.StatusOK, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRouter(tt.user)
+			ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+			r.POST("/new", requireAuth(), ok)
+			r.POST("/api/posts", requireAuth(), ok)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			if tt.wantCode != "" {
+				var body struct{ Error APIError }
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("body %q: %v", w.Body, err)
+				}
+				if body.Error.Code != tt.wantCode {
+					t.Errorf("error code = %q, want %q", body.Error.Code, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestCanModify(t *testing.T) {
+	alice := &User{ID: 1, Username: "alice"}
+	bob := &User{ID: 2, Username: "bob"}
+	admins := []string{"root"}
+	aliceID := alice.ID
+	tests := []struct {
+		name     string
+		user     *User
+		authorID *int
+		want     bool
+	}{
+		{"author", alice, &aliceID, true},
+		{"another user", bob, &aliceID, false},
+		{"anonymous visitor", nil, &aliceID, false},
+		{"admin", &User{ID: 3, Username: "root"}, &aliceID, true},
+		{"content without an author", alice, nil, false},
+		{"admin on content without an author", &User{ID: 3, Username: "root"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.user != nil {
+				c.Set(userContextKey, tt.user)
+			}
+			if got := canModify(c, tt.authorID, admins); got != tt.want {
+				t.Errorf("canModify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorName(t *testing.T) {
+	alice := &User{ID: 1, Username: "alice"}
+	tests := []struct {
+		name      string
+		user      *User
+		submitted string
+		want      string
+	}{
+		{"anonymous without a name", nil, "", anonymousAuthor},
+		{"anonymous with a name", nil, "  Jane Doe ", "Jane Doe"},
+		{"anonymous name cut to the column", nil, strings.Repeat("x", maxAuthorLength+10), strings.Repeat("x", maxAuthorLength)},
+		{"logged in without a name", alice, " ", "alice"},
+		{"logged in under the username", alice, "alice", "alice"},
+		{"logged in under another name", alice, "Jane", "Jane (alice)"},
+		{"another account's name stays marked", alice, "root", "root (alice)"},
+		{"long name leaves room for the username", alice, strings.Repeat("x", maxAuthorLength), strings.Repeat("x", maxAuthorLength-len(" (alice)")) + " (alice)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.user != nil {
+				c.Set(userContextKey, tt.user)
+			}
+			if got := authorName(c, tt.submitted); got != tt.want {
+				t.Errorf("authorName(%q) = %q, want %q", tt.submitted, got, tt.want)
+			}
+		})
+	}
+}
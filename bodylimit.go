@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitRequestBody is a middleware that rejects POST bodies larger than limit bytes with a 413
+// Bodies announcing a larger Content-Length are refused before anything is read.
+// Other bodies are capped with http.MaxBytesReader, and form submissions are
+// parsed here so an oversized form is reported as such instead of reaching the
+// handler with its fields silently missing. Routes taking file uploads are
+// listed in uploads with their own, larger limit.
+func limitRequestBody(defaultLimit int64, uploads map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPost || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+		limit := defaultLimit
+		if l, ok := uploads[c.FullPath()]; ok {
+			limit = l
+		}
+		if c.Request.ContentLength > limit {
+			abortTooLarge(c, limit)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
+		var err error
+		switch c.ContentType() {
+		case "application/x-www-form-urlencoded":
+			err = c.Request.ParseForm()
+		case "multipart/form-data":
+			err = c.Request.ParseMultipartForm(limit)
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortTooLarge(c, limit)
+			return
+		}
+		c.Next()
+	}
+}
+
+// abortTooLarge aborts with a 413 naming the size limit
+func abortTooLarge(c *gin.Context, limit int64) {
+	msg := "Request body must be at most " + strconv.FormatInt(limit, 10) + " bytes"
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		abortJSON(c, http.StatusRequestEntityTooLarge, errCodeTooLarge, msg)
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": msg})
+}
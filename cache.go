@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// homepageCacheEntries caps how many listing pages are cached at once
+// Page numbers come from the query string, so without a cap a crawler could grow the map without bound.
+const homepageCacheEntries = 64
+
+// homepageKey identifies one page of the front page listing
+type homepageKey struct {
+	sort   string
+	limit  int
+	offset int
+}
+
+// homepagePage is a cached page of the front page listing
+type homepagePage struct {
+	posts    []Post
+	total    int
+	cachedAt time.Time
+}
+
+// homepageCache keeps recently loaded front page listings for a short time
+// Cached pages hold no per-user data, since the current user is added when the
+// page is rendered, so logged-in and anonymous visitors share them.
+// A nil cache, or one with a zero ttl, caches nothing.
+type homepageCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	pages map[homepageKey]homepagePage
+}
+
+// newHomepageCache returns a cache keeping listings for ttl
+func newHomepageCache(ttl time.Duration) *homepageCache {
+	return &homepageCache{ttl: ttl, pages: make(map[homepageKey]homepagePage)}
+}
+
+// get returns the cached page for key if it is younger than the ttl
+func (h *homepageCache) get(key homepageKey) (homepagePage, bool) {
+	if h == nil || h.ttl <= 0 {
+		return homepagePage{}, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	page, ok := h.pages[key]
+	if !ok || time.Since(page.cachedAt) > h.ttl {
+		return homepagePage{}, false
+	}
+	return page, true
+}
+
+// set stores a freshly loaded page, starting over when the cache is full
+func (h *homepageCache) set(key homepageKey, posts []Post, total int) {
+	if h == nil || h.ttl <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.pages) >= homepageCacheEntries {
+		h.pages = make(map[homepageKey]homepagePage)
+	}
+	h.pages[key] = homepagePage{posts: posts, total: total, cachedAt: time.Now()}
+}
+
+// invalidate drops every cached page
+func (h *homepageCache) invalidate() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pages = make(map[homepageKey]homepagePage)
+}
+
+// invalidateOnWrite is a middleware that empties the cache after every successful POST
+// New posts, comments, votes, edits and moderation all go through POST routes,
+// so the front page never stays stale after a change made through the site.
+func (h *homepageCache) invalidateOnWrite() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Request.Method == http.MethodPost && c.Writer.Status() < http.StatusBadRequest {
+			h.invalidate()
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recentComment is a comment listed outside its thread together with the post it belongs to
+type recentComment struct {
+	Comment
+	Post Post // Only ID, Title and Slug are set
+}
+
+// countRecentComments returns the number of comments on live posts
+func countRecentComments(ctx context.Context, db *sql.DB) (int, error) {
+	var total int
+	err := db.QueryRowContext(ctx, `
+        SELECT COUNT(*)
+        FROM comments c
+        JOIN posts p ON p.id = c.post_id
+        WHERE p.deleted_at IS NULL
+    `).Scan(&total)
+	return total, err
+}
+
+// listRecentComments returns a page of the newest comments across all live posts
+// Dead comments keep their place but lose their content, as in threads.
+func listRecentComments(ctx context.Context, db *sql.DB, limit, offset int) ([]recentComment, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT `+recentCommentColumns+`
+        FROM comments c
+        JOIN posts p ON p.id = c.post_id
+        WHERE p.deleted_at IS NULL
+        ORDER BY c.created_at DESC, c.id DESC
+        LIMIT $1 OFFSET $2
+    `, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecentComments(rows)
+}
+
+// listUserComments returns the newest comments a user wrote on live posts
+func listUserComments(ctx context.Context, db *sql.DB, authorID, limit int) ([]recentComment, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT `+recentCommentColumns+`
+        FROM comments c
+        JOIN posts p ON p.id = c.post_id
+        WHERE p.deleted_at IS NULL AND c.author_id = $1
+        ORDER BY c.created_at DESC, c.id DESC
+        LIMIT $2
+    `, authorID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecentComments(rows)
+}
+
+// recentCommentColumns lists the columns scanRecentComments reads, from comments c joined to posts p
+const recentCommentColumns = "c.id, c.content, c.post_id, c.created_at, c.status, p.title, p.slug"
+
+// scanRecentComments reads comment rows with their post's title and slug and closes rows
+func scanRecentComments(rows *sql.Rows) ([]recentComment, error) {
+	defer rows.Close()
+
+	var comments []recentComment
+	for rows.Next() {
+		var comment recentComment
+		if err := rows.Scan(&comment.ID, &comment.Content, &comment.PostID, &comment.CreatedAt, &comment.Status, &comment.Post.Title, &comment.Post.Slug); err != nil {
+			return nil, err
+		}
+		if comment.Status == commentDead {
+			comment.Content = ""
+		}
+		comment.Post.ID = comment.PostID
+		comment.Post.Slug = postSlug(comment.Post.Slug, comment.Post.Title)
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// registerCommentRoutes registers the site-wide comment listing
+func registerCommentRoutes(r *gin.Engine, db *sql.DB) {
+	// Route to display the newest comments across all posts
+	r.GET("/comments", func(c *gin.Context) {
+		page, perPage := parsePageParams(c)
+
+		total, err := countRecentComments(c.Request.Context(), db)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		comments, err := listRecentComments(c.Request.Context(), db, perPage, (page-1)*perPage)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		data := pageData(c, page, perPage, total)
+		data["Comments"] = comments
+		renderTemplate(c, "comments.html", data)
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postValidators returns the Last-Modified time and ETag of a post's detail page
+// The time covers edits to the post and comments being written, edited,
+// reparented or moderated. Votes, pins and deleted comments don't move it, so
+// the ETag also folds in a hash of the points, version, comment count, pin,
+// image and tags to catch those.
+func postValidators(post *Post, lastComment time.Time) (time.Time, string) {
+	modified := post.UpdatedAt
+	if post.CreatedAt.After(modified) {
+		modified = post.CreatedAt
+	}
+	if lastComment.After(modified) {
+		modified = lastComment
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%d|%d|%t|%s|%s", post.Points, post.Version, post.CommentCount, post.Pinned, post.ImagePath, strings.Join(post.Tags, ","))
+	etag := fmt.Sprintf(`"%d-%d-%x"`, post.ID, modified.Unix(), h.Sum64())
+	return modified, etag
+}
+
+// notModified sets the caching headers of a page and reports whether the request's
+// If-None-Match or If-Modified-Since header shows the client already has it
+// If-None-Match takes precedence when both are sent. Tags are compared weakly
+// because the gzip middleware marks compressed responses as weak.
+func notModified(c *gin.Context, modified time.Time, etag string) bool {
+	modified = modified.UTC().Truncate(time.Second)
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", modified.Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-cache")
+
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil {
+		return !modified.After(since)
+	}
+	return false
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the application settings loaded from the environment
+type Config struct {
+	Driver       string        // Database driver, postgres or sqlite (DB_DRIVER)
+	DSN          string        // Connection string: PG_DSN for postgres, SQLITE_DSN for sqlite
+	Port         string        // HTTP listen port (PORT)
+	BaseURL      string        // Public URL of the site used for absolute links, derived from requests if empty; emails only link to the site when set (BASE_URL)
+	ReadTimeout  time.Duration // Maximum duration for reading a request (READ_TIMEOUT)
+	WriteTimeout time.Duration // Maximum duration for writing a response (WRITE_TIMEOUT)
+	IdleTimeout  time.Duration // Maximum time an idle keep-alive connection is kept open (IDLE_TIMEOUT)
+
+	TrustedProxies []string // Proxy IPs or CIDR ranges whose X-Forwarded-* headers are trusted, loopback by default (TRUSTED_PROXIES, comma-separated)
+
+	MaxOpenConns    int           // Maximum number of open database connections (DB_MAX_OPEN_CONNS)
+	MaxIdleConns    int           // Maximum number of idle database connections (DB_MAX_IDLE_CONNS)
+	ConnMaxLifetime time.Duration // Maximum time a database connection may be reused (DB_CONN_MAX_LIFETIME)
+	QueryTimeout    time.Duration // Maximum time the database work of a single request may take (DB_QUERY_TIMEOUT)
+	ConnectAttempts int           // Pings made at startup before giving up on the database (DB_CONNECT_ATTEMPTS)
+	ConnectTimeout  time.Duration // Maximum time to wait for the database at startup (DB_CONNECT_TIMEOUT)
+
+	LogLevel slog.Level // Minimum level of log lines to emit (LOG_LEVEL)
+	DevMode  bool       // Read templates and static files from disk instead of the binary (DEV_MODE)
+
+	SiteUser string // Username required through HTTP Basic Auth on every page, empty for a public site (SITE_USER)
+	SitePass string // Password required along with SITE_USER (SITE_PASS)
+
+	RateLimitPerMinute int // Sustained POST requests allowed per client IP per minute (RATE_LIMIT_PER_MINUTE)
+	RateLimitBurst     int // POST requests a client IP may make in a burst (RATE_LIMIT_BURST)
+
+	MaxBodySize  int64  // Largest accepted POST body in bytes (MAX_BODY_SIZE)
+	MaxImageSize int64  // Largest accepted post image in bytes, on top of MAX_BODY_SIZE (MAX_IMAGE_SIZE)
+	ImageDir     string // Directory post images are stored in, empty to keep them in the database (IMAGE_DIR)
+
+	PointsFloor       int           // Lowest score downvotes can push a post to (POINTS_FLOOR)
+	CommentsPerPage   int           // Top-level comments shown per page of a discussion (COMMENTS_PER_PAGE)
+	CommentEditWindow time.Duration // How long after posting a comment can still be edited (COMMENT_EDIT_WINDOW)
+	CommentCooldown   time.Duration // Least time between two comments from one user or IP, 0 for no limit (COMMENT_COOLDOWN)
+	MaxCommentDepth   int           // Deepest level of nested replies, top-level comments being level 1 (MAX_COMMENT_DEPTH)
+	FlagThreshold     int           // Most flags from distinct users a post may have before it is hidden from the front page, 0 to never hide (FLAG_THRESHOLD)
+	MaxPostsPerDomain int           // Posts from one site shown before the rest of its posts are pushed down the front page, 0 for no limit (MAX_POSTS_PER_DOMAIN)
+	CountDeadComments bool          // Include dead comments in comment counts (COUNT_DEAD_COMMENTS)
+	HotScoreInterval  time.Duration // How often the stored hot scores of all posts are recomputed (HOT_SCORE_INTERVAL)
+	HomepageCacheTTL  time.Duration // How long front page listings are cached, 0 to disable the cache (HOMEPAGE_CACHE_TTL)
+
+	AdminUsers     []string // Usernames allowed to use the admin dashboard (ADMIN_USERS, comma-separated)
+	MaxPinnedPosts int      // Posts admins may pin to the top of the front page at once (MAX_PINNED_POSTS)
+	SpamKeywords   []string // Phrases that get a new post rejected as spam, nil for the built-in list (SPAM_KEYWORDS, comma-separated)
+
+	CORSOrigins []string // Origins allowed to call the API from a browser, none by default (CORS_ALLOWED_ORIGINS, comma-separated)
+	CORSMethods []string // Methods allowed in cross-origin API requests (CORS_ALLOWED_METHODS, comma-separated)
+	CORSHeaders []string // Request headers allowed in cross-origin API requests (CORS_ALLOWED_HEADERS, comma-separated)
+
+	SMTPHost     string // Mail server for reply notifications, empty to disable email (SMTP_HOST)
+	SMTPPort     int    // Mail server port (SMTP_PORT)
+	SMTPUsername string // Mail server login, empty to send without authentication (SMTP_USERNAME)
+	SMTPPassword string // Mail server password (SMTP_PASSWORD)
+	SMTPFrom     string // Sender address of notification emails (SMTP_FROM)
+}
+
+// defaultSQLiteDSN stores the local development database next to the binary
+// The busy timeout lets concurrent requests wait for the write lock instead of failing.
+const defaultSQLiteDSN = "file:hackernews.db?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+
+// LoadConfig reads the configuration from environment variables and applies defaults
+// It returns an error if a required variable is missing or a value cannot be parsed.
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		Driver: envString("DB_DRIVER", driverPostgres),
+		Port:   envString("PORT", "8080"),
+	}
+	if cfg.BaseURL = strings.TrimRight(os.Getenv("BASE_URL"), "/"); cfg.BaseURL != "" {
+		u, err := url.Parse(cfg.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid BASE_URL %q: must be an http or https URL such as https://news.example.com", cfg.BaseURL)
+		}
+	}
+	switch cfg.Driver {
+	case driverPostgres:
+		cfg.DSN = os.Getenv("PG_DSN")
+		if cfg.DSN == "" {
+			return nil, errors.New("PG_DSN environment variable is required")
+		}
+	case driverSQLite:
+		cfg.DSN = envString("SQLITE_DSN", defaultSQLiteDSN)
+	default:
+		return nil, fmt.Errorf("invalid DB_DRIVER %q: must be postgres or sqlite", cfg.Driver)
+	}
+
+	var err error
+	if cfg.ReadTimeout, err = envDuration("READ_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.WriteTimeout, err = envDuration("WRITE_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.IdleTimeout, err = envDuration("IDLE_TIMEOUT", 120*time.Second); err != nil {
+		return nil, err
+	}
+	// Only list proxies that overwrite X-Forwarded-For, since any client able to
+	// connect from a trusted address can set its own IP through the header
+	if cfg.TrustedProxies = envList("TRUSTED_PROXIES"); cfg.TrustedProxies == nil {
+		cfg.TrustedProxies = []string{"127.0.0.1", "::1"}
+	}
+	if cfg.MaxOpenConns, err = envInt("DB_MAX_OPEN_CONNS", 25); err != nil {
+		return nil, err
+	}
+	if cfg.MaxIdleConns, err = envInt("DB_MAX_IDLE_CONNS", 10); err != nil {
+		return nil, err
+	}
+	if cfg.ConnMaxLifetime, err = envDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.QueryTimeout, err = envDuration("DB_QUERY_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ConnectAttempts, err = envInt("DB_CONNECT_ATTEMPTS", 10); err != nil {
+		return nil, err
+	}
+	if cfg.ConnectAttempts < 1 {
+		return nil, errors.New("DB_CONNECT_ATTEMPTS must be positive")
+	}
+	if cfg.ConnectTimeout, err = envDuration("DB_CONNECT_TIMEOUT", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.LogLevel, err = parseLogLevel(envString("LOG_LEVEL", "info")); err != nil {
+		return nil, err
+	}
+	if cfg.DevMode, err = envBool("DEV_MODE", false); err != nil {
+		return nil, err
+	}
+	cfg.SiteUser = os.Getenv("SITE_USER")
+	cfg.SitePass = os.Getenv("SITE_PASS")
+	if (cfg.SiteUser == "") != (cfg.SitePass == "") {
+		return nil, errors.New("SITE_USER and SITE_PASS must be set together")
+	}
+	if cfg.RateLimitPerMinute, err = envInt("RATE_LIMIT_PER_MINUTE", 20); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimitBurst, err = envInt("RATE_LIMIT_BURST", 5); err != nil {
+		return nil, err
+	}
+	maxBodySize, err := envInt("MAX_BODY_SIZE", 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	if maxBodySize < 1 {
+		return nil, errors.New("MAX_BODY_SIZE must be positive")
+	}
+	cfg.MaxBodySize = int64(maxBodySize)
+	maxImageSize, err := envInt("MAX_IMAGE_SIZE", 2<<20)
+	if err != nil {
+		return nil, err
+	}
+	if maxImageSize < 1 {
+		return nil, errors.New("MAX_IMAGE_SIZE must be positive")
+	}
+	cfg.MaxImageSize = int64(maxImageSize)
+	cfg.ImageDir = os.Getenv("IMAGE_DIR")
+	if cfg.RateLimitPerMinute < 1 || cfg.RateLimitBurst < 1 {
+		return nil, errors.New("RATE_LIMIT_PER_MINUTE and RATE_LIMIT_BURST must be positive")
+	}
+	if cfg.PointsFloor, err = envInt("POINTS_FLOOR", 0); err != nil {
+		return nil, err
+	}
+	if cfg.CommentsPerPage, err = envInt("COMMENTS_PER_PAGE", 50); err != nil {
+		return nil, err
+	}
+	if cfg.CommentsPerPage < 1 {
+		return nil, errors.New("COMMENTS_PER_PAGE must be positive")
+	}
+	if cfg.CommentEditWindow, err = envDuration("COMMENT_EDIT_WINDOW", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.CommentCooldown, err = envDuration("COMMENT_COOLDOWN", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.CommentCooldown < 0 {
+		return nil, errors.New("COMMENT_COOLDOWN must not be negative")
+	}
+	if cfg.MaxCommentDepth, err = envInt("MAX_COMMENT_DEPTH", 8); err != nil {
+		return nil, err
+	}
+	if cfg.MaxCommentDepth < 1 {
+		return nil, errors.New("MAX_COMMENT_DEPTH must be positive")
+	}
+	if cfg.FlagThreshold, err = envInt("FLAG_THRESHOLD", 5); err != nil {
+		return nil, err
+	}
+	if cfg.FlagThreshold < 0 {
+		return nil, errors.New("FLAG_THRESHOLD must not be negative")
+	}
+	if cfg.MaxPostsPerDomain, err = envInt("MAX_POSTS_PER_DOMAIN", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MaxPostsPerDomain < 0 {
+		return nil, errors.New("MAX_POSTS_PER_DOMAIN must not be negative")
+	}
+	if cfg.CountDeadComments, err = envBool("COUNT_DEAD_COMMENTS", true); err != nil {
+		return nil, err
+	}
+	if cfg.HotScoreInterval, err = envDuration("HOT_SCORE_INTERVAL", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.HotScoreInterval <= 0 {
+		return nil, errors.New("HOT_SCORE_INTERVAL must be positive")
+	}
+	if cfg.HomepageCacheTTL, err = envDuration("HOMEPAGE_CACHE_TTL", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HomepageCacheTTL < 0 {
+		return nil, errors.New("HOMEPAGE_CACHE_TTL must not be negative")
+	}
+	cfg.AdminUsers = envList("ADMIN_USERS")
+	if cfg.MaxPinnedPosts, err = envInt("MAX_PINNED_POSTS", 3); err != nil {
+		return nil, err
+	}
+	if cfg.MaxPinnedPosts < 0 {
+		return nil, errors.New("MAX_PINNED_POSTS must not be negative")
+	}
+	cfg.SpamKeywords = envList("SPAM_KEYWORDS")
+
+	cfg.CORSOrigins = envList("CORS_ALLOWED_ORIGINS")
+	if cfg.CORSMethods = envList("CORS_ALLOWED_METHODS"); cfg.CORSMethods == nil {
+		cfg.CORSMethods = []string{"GET", "POST"}
+	}
+	if cfg.CORSHeaders = envList("CORS_ALLOWED_HEADERS"); cfg.CORSHeaders == nil {
+		cfg.CORSHeaders = []string{"Content-Type"}
+	}
+
+	cfg.SMTPHost = os.Getenv("SMTP_HOST")
+	if cfg.SMTPPort, err = envInt("SMTP_PORT", 587); err != nil {
+		return nil, err
+	}
+	cfg.SMTPUsername = os.Getenv("SMTP_USERNAME")
+	cfg.SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	cfg.SMTPFrom = os.Getenv("SMTP_FROM")
+	if cfg.SMTPHost != "" && cfg.SMTPFrom == "" {
+		return nil, errors.New("SMTP_FROM is required when SMTP_HOST is set")
+	}
+	return cfg, nil
+}
+
+// envString returns the value of the environment variable key, or def if it is unset or empty
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envList splits the comma-separated environment variable key into trimmed, non-empty items
+func envList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envInt parses the environment variable key as an integer, or returns def if it is unset
+func envInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be an integer", key, v)
+	}
+	return n, nil
+}
+
+// envBool parses the environment variable key as a boolean (e.g. "true" or "1"), or returns def if it is unset
+func envBool(key string, def bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: must be true or false", key, v)
+	}
+	return b, nil
+}
+
+// envDuration parses the environment variable key as a duration (e.g. "30s"), or returns def if it is unset
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be a duration such as 30s", key, v)
+	}
+	return d, nil
+}
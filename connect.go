@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// connectInitialBackoff is the wait after the first failed ping; it doubles after each attempt
+	connectInitialBackoff = 500 * time.Millisecond
+	// connectMaxBackoff caps the wait between two pings
+	connectMaxBackoff = 10 * time.Second
+	// connectPingTimeout bounds a single ping so a hung connection attempt counts as a failure
+	connectPingTimeout = 5 * time.Second
+)
+
+// waitForDB pings the database until it answers, backing off exponentially between attempts
+// This lets the app start before the database is ready, as often happens with
+// docker-compose. It gives up after attempts pings or once timeout has elapsed.
+func waitForDB(ctx context.Context, db *sql.DB, attempts int, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	backoff := connectInitialBackoff
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancelPing := context.WithTimeout(ctx, connectPingTimeout)
+		err := db.PingContext(pingCtx)
+		cancelPing()
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("database unreachable after %d attempts: %w", attempt, err)
+		}
+		slog.Warn("Database not ready, retrying", "attempt", attempt, "retry_in", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database unreachable after %s: %w", timeout, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, connectMaxBackoff)
+	}
+}
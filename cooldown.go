@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cooldownCleanupInterval is how often expired cooldown entries are swept
+const cooldownCleanupInterval = time.Minute
+
+// cooldown spaces out actions by the same client, such as posting comments
+// Clients are keyed like voters: by user ID when logged in, by IP otherwise.
+type cooldown struct {
+	mu       sync.Mutex
+	last     map[string]time.Time
+	interval time.Duration
+}
+
+// newCooldown returns a cooldown requiring interval between actions, or none if interval is 0
+func newCooldown(interval time.Duration) *cooldown {
+	return &cooldown{last: make(map[string]time.Time), interval: interval}
+}
+
+// wait returns how long key must still wait before acting again
+// When it returns 0 the action is recorded, so the next one has to wait the
+// full interval; call release if the action then fails.
+func (cd *cooldown) wait(key string) time.Duration {
+	if cd.interval <= 0 {
+		return 0
+	}
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	now := time.Now()
+	if remaining := cd.last[key].Add(cd.interval).Sub(now); remaining > 0 {
+		return remaining
+	}
+	cd.last[key] = now
+	return 0
+}
+
+// release forgets the action recorded by the last wait of key, so a failed action doesn't hold up a retry
+func (cd *cooldown) release(key string) {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	delete(cd.last, key)
+}
+
+// cleanup drops clients whose cooldown has run out
+func (cd *cooldown) cleanup() {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	for key, last := range cd.last {
+		if time.Since(last) >= cd.interval {
+			delete(cd.last, key)
+		}
+	}
+}
+
+// runCleanup periodically sweeps expired entries until ctx is cancelled
+func (cd *cooldown) runCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cooldownCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cd.cleanup()
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCooldownWait(t *testing.T) {
+	const interval = 30 * time.Second
+	tests := []struct {
+		name     string
+		interval time.Duration
+		lastAgo  time.Duration // How long ago key last acted; 0 for never
+		wantWait bool
+	}{
+		{"first action", interval, 0, false},
+		{"right after the last action", interval, time.Second, true},
+		{"just inside the interval", interval, interval - time.Second, true},
+		{"interval has passed", interval, interval, false},
+		{"long ago", interval, time.Hour, false},
+		{"no cooldown", 0, time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cd := newCooldown(tt.interval)
+			if tt.lastAgo > 0 {
+				cd.last["user:1"] = time.Now().Add(-tt.lastAgo)
+			}
+			wait := cd.wait("user:1")
+			if (wait > 0) != tt.wantWait {
+				t.Fatalf("wait = %v, want waiting %v", wait, tt.wantWait)
+			}
+			if tt.wantWait && wait > tt.interval-tt.lastAgo {
+				t.Errorf("wait = %v, longer than the %v left", wait, tt.interval-tt.lastAgo)
+			}
+			if !tt.wantWait && tt.interval > 0 {
+				// An allowed action starts a new full interval
+				if again := cd.wait("user:1"); again <= interval-time.Second {
+					t.Errorf("next wait = %v, want about %v", again, interval)
+				}
+			}
+		})
+	}
+}
+
+func TestCooldownRelease(t *testing.T) {
+	cd := newCooldown(time.Minute)
+	if wait := cd.wait("user:1"); wait != 0 {
+		t.Fatalf("first wait = %v", wait)
+	}
+	if wait := cd.wait("ip:10.0.0.1"); wait != 0 {
+		t.Errorf("another client has to wait %v", wait)
+	}
+	// The action failed, so the next try goes through at once
+	cd.release("user:1")
+	if wait := cd.wait("user:1"); wait != 0 {
+		t.Errorf("wait after release = %v, want 0", wait)
+	}
+	if wait := cd.wait("ip:10.0.0.1"); wait == 0 {
+		t.Error("release of one client let another act again")
+	}
+}
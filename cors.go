@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsMaxAge is how long in seconds browsers may cache a preflight response
+const corsMaxAge = "600"
+
+// corsHeaders is a middleware that lets the listed origins call the API from a browser
+// Requests from other origins get no CORS headers, so browsers keep blocking
+// them. An origin of "*" allows any site but without cookies, since browsers
+// refuse credentials with a wildcard. Preflight OPTIONS requests are answered
+// here and never reach a handler.
+func corsHeaders(origins, methods, headers []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Origin")
+		origin := c.GetHeader("Origin")
+		if origin == "" || (!allowed[origin] && !allowed["*"]) {
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		if allowed[origin] {
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+		} else {
+			h.Set("Access-Control-Allow-Origin", "*")
+		}
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			h.Set("Access-Control-Allow-Headers", allowHeaders)
+			h.Set("Access-Control-Max-Age", corsMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
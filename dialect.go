@@ -0,0 +1,34 @@
+package main
+
+import (
+	"database/sql"
+
+	"modernc.org/sqlite"
+)
+
+// Supported values for the DB_DRIVER setting
+const (
+	driverPostgres = "postgres"
+	driverSQLite   = "sqlite"
+)
+
+// Queries are written for PostgreSQL and shared with SQLite wherever possible.
+// The modernc.org/sqlite driver binds $N placeholders by ordinal, so the
+// placeholder style is the same for both drivers; only statements that use
+// dialect-specific syntax (DDL, full-text search) need a separate variant.
+
+// isSQLite reports whether db was opened with the SQLite driver
+func isSQLite(db *sql.DB) bool {
+	_, ok := db.Driver().(*sqlite.Driver)
+	return ok
+}
+
+// dialectQuery returns the SQLite variant of a query when db uses SQLite
+// and the PostgreSQL variant otherwise. An empty SQLite variant means the
+// PostgreSQL query works on both.
+func dialectQuery(db *sql.DB, postgres, sqliteQuery string) string {
+	if sqliteQuery != "" && isSQLite(db) {
+		return sqliteQuery
+	}
+	return postgres
+}
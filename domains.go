@@ -0,0 +1,34 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerDomainRoutes registers the per-site post listings
+func registerDomainRoutes(r *gin.Engine, db *sql.DB) {
+	r.GET("/from/:domain", func(c *gin.Context) {
+		host := normalizeHost(c.Param("domain"))
+		page, perPage := parsePageParams(c)
+
+		opts := postListOptions{Sort: parseSort(c.Query("sort")), Host: host, Limit: perPage, Offset: (page - 1) * perPage}
+		total, err := countPosts(c.Request.Context(), db, opts)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		posts, err := listPosts(c.Request.Context(), db, opts)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		data := pageData(c, page, perPage, total)
+		data["Posts"] = posts
+		data["Sort"] = opts.Sort
+		data["Domain"] = host
+		renderTemplate(c, "index.html", data)
+	})
+}
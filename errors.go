@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine-readable error codes returned by the JSON API
+const (
+	errCodeBadRequest   = "bad_request"
+	errCodeUnauthorized = "unauthorized"
+	errCodeForbidden    = "forbidden"
+	errCodeNotFound     = "not_found"
+	errCodeTooLarge     = "payload_too_large"
+	errCodeRateLimited  = "rate_limited"
+	errCodeInternal     = "internal_error"
+)
+
+// APIError is the body of every error returned under /api, wrapped in an "error" field
+// Clients should branch on Code; Message is meant for humans and may change.
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// abortJSON aborts an API request with status and an APIError body
+func abortJSON(c *gin.Context, status int, code, msg string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": APIError{Code: code, Message: msg, RequestID: getRequestID(c)}})
+}
+
+// serverError logs an unexpected error with its request context and aborts with a generic 500
+// The error itself is never sent to the client, since it may contain SQL or other internal details.
+// API routes get a JSON body and browser routes get the 500 page, both showing
+// the request ID so users can quote it when reporting the problem.
+func serverError(c *gin.Context, err error) {
+	slog.Error("Internal server error",
+		"error", err,
+		"request_id", getRequestID(c),
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+	)
+	abortServerError(c)
+}
+
+// abortServerError aborts with a 500 JSON body under /api and the 500 page elsewhere
+func abortServerError(c *gin.Context) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		abortJSON(c, http.StatusInternalServerError, errCodeInternal, "internal server error")
+		return
+	}
+	renderServerError(c)
+	c.Abort()
+}
+
+// recoverPanics is a middleware that turns a panicking handler into a logged 500
+// It replaces gin.Recovery so users see the same 500 page as for other errors.
+// If the handler already sent part of the response, nothing more is written
+// and the client is left with the truncated response. http.ErrAbortHandler is
+// re-raised so net/http can abort the connection as intended.
+func recoverPanics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			slog.Error("Panic while handling request",
+				"panic", rec,
+				"stack", string(debug.Stack()),
+				"request_id", getRequestID(c),
+				"method", c.Request.Method,
+				"path", c.Request.URL.Path,
+			)
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			abortServerError(c)
+		}()
+		c.Next()
+	}
+}
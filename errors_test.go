@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAPIErrorShape checks that failures under /api all come back as an APIError, whichever layer rejects them
+func TestAPIErrorShape(t *testing.T) {
+	tests := []struct {
+		name        string
+		middleware  gin.HandlerFunc
+		handler     gin.HandlerFunc
+		requests    int // The last response is checked
+		contentType string
+		wantStatus  int
+		wantCode    string
+	}{
+		{"handler error", nil, func(c *gin.Context) {
+			abortJSON(c, http.StatusBadRequest, errCodeBadRequest, "Title is required")
+		}, 1, "application/json", http.StatusBadRequest, errCodeBadRequest},
+		{"server error", nil, func(c *gin.Context) {
+			serverError(c, errors.New("connection refused"))
+		}, 1, "application/json", http.StatusInternalServerError, errCodeInternal},
+		{"login required", requireAuth(), nil, 1, "application/json", http.StatusUnauthorized, errCodeUnauthorized},
+		{"rate limited", newRateLimiter(1, 1).middleware(), nil, 2, "application/json", http.StatusTooManyRequests, errCodeRateLimited},
+		{"form post without a CSRF token", csrfProtect(), nil, 1, "application/x-www-form-urlencoded", http.StatusForbidden, errCodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRouter(nil)
+			handlers := []gin.HandlerFunc{}
+			if tt.middleware != nil {
+				handlers = append(handlers, tt.middleware)
+			}
+			if tt.handler == nil {
+				tt.handler = func(c *gin.Context) { c.Status(http.StatusOK) }
+			}
+			r.POST("/api/posts", append(handlers, tt.handler)...)
+
+			var w *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				w = httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader("{}"))
+				req.Header.Set("Content-Type", tt.contentType)
+				r.ServeHTTP(w, req)
+			}
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var body map[string]APIError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not an APIError: %v", w.Body, err)
+			}
+			if got := body["error"]; got.Code != tt.wantCode || got.Message == "" {
+				t.Errorf("error = %+v, want code %q with a message", got, tt.wantCode)
+			}
+		})
+	}
+}
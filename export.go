@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// exportFlushRows is how many CSV rows are written between flushes to the client
+	exportFlushRows = 100
+	// exportTimeout bounds an export in place of the query and write timeouts of normal requests
+	exportTimeout = 10 * time.Minute
+)
+
+// exportPostsHeader is the header row of the posts CSV export
+var exportPostsHeader = []string{"id", "title", "link", "content", "created_at", "points", "comment_count"}
+
+// csvCell escapes user text for a CSV cell
+// Spreadsheets run a cell starting with =, +, -, @, a tab or a carriage return
+// as a formula, so such text is prefixed with a quote to keep it literal.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// registerExportRoutes registers the admin-only data export routes
+func registerExportRoutes(r *gin.Engine, db *sql.DB, admins []string) {
+	// Route to download every live post as CSV, oldest first
+	// Rows are streamed from the database cursor, so the export never sits in
+	// memory as a whole. Once streaming has started an error can only be
+	// logged, leaving the client with a truncated file.
+	r.GET("/export/posts.csv", requireAuth(), requireAdmin(admins), func(c *gin.Context) {
+		// A large export outlasts the request deadlines; a client that goes away
+		// still ends it at the next failed write.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), exportTimeout)
+		defer cancel()
+		http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(exportTimeout))
+
+		rows, err := db.QueryContext(ctx, `
+            SELECT `+postColumns+`, COUNT(c.id)
+            FROM posts p
+            LEFT JOIN comments c ON c.post_id = p.id`+countedComments()+`
+            WHERE p.deleted_at IS NULL
+            GROUP BY p.id
+            ORDER BY p.id
+        `)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		defer rows.Close()
+
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="posts-`+time.Now().UTC().Format("2006-01-02")+`.csv"`)
+		w := csv.NewWriter(c.Writer)
+		if err := w.Write(exportPostsHeader); err != nil {
+			return
+		}
+		for n := 1; rows.Next(); n++ {
+			post, err := scanPost(rows)
+			if err != nil {
+				slog.Error("Cannot export post", "error", err, "request_id", getRequestID(c))
+				break
+			}
+			if err := w.Write([]string{
+				strconv.Itoa(post.ID),
+				csvCell(post.Title),
+				csvCell(post.Link),
+				csvCell(post.Content),
+				post.CreatedAt.Format(time.RFC3339),
+				strconv.Itoa(post.Points),
+				strconv.Itoa(post.CommentCount),
+			}); err != nil {
+				// The client went away
+				return
+			}
+			if n%exportFlushRows == 0 {
+				w.Flush()
+				c.Writer.Flush()
+			}
+		}
+		if err := rows.Err(); err != nil {
+			slog.Error("Cannot export posts", "error", err, "request_id", getRequestID(c))
+		}
+		w.Flush()
+	})
+}
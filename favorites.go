@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// toggleFavorite saves a post for a user, or removes it if it was already saved
+// It returns whether the post is saved afterwards, or sql.ErrNoRows if the post does not exist.
+func toggleFavorite(ctx context.Context, db *sql.DB, userID, postID int) (bool, error) {
+	saved := false
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRowContext(ctx, "SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL", postID).Scan(&exists); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, "DELETE FROM favorites WHERE user_id = $1 AND post_id = $2", userID, postID)
+		if err != nil {
+			return err
+		}
+		// A deleted row means the post was saved and is now removed
+		if err := requireRowsAffected(res); err != sql.ErrNoRows {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO favorites (user_id, post_id, created_at) VALUES ($1, $2, CURRENT_TIMESTAMP)", userID, postID); err != nil {
+			return err
+		}
+		saved = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return saved, nil
+}
+
+// isFavorite reports whether a user has saved a post
+func isFavorite(ctx context.Context, db *sql.DB, userID, postID int) (bool, error) {
+	var exists int
+	err := db.QueryRowContext(ctx, "SELECT 1 FROM favorites WHERE user_id = $1 AND post_id = $2", userID, postID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// countFavorites returns the number of posts a user has saved
+func countFavorites(ctx context.Context, db *sql.DB, userID int) (int, error) {
+	var total int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM favorites f JOIN posts p ON p.id = f.post_id WHERE f.user_id = $1 AND p.deleted_at IS NULL", userID).Scan(&total)
+	return total, err
+}
+
+// listFavorites returns a page of the posts a user has saved, most recently saved first
+func listFavorites(ctx context.Context, db *sql.DB, userID, limit, offset int) ([]Post, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT `+postColumns+`, COUNT(c.id)
+        FROM favorites f
+        JOIN posts p ON p.id = f.post_id
+        LEFT JOIN comments c ON c.post_id = p.id`+countedComments()+`
+        WHERE f.user_id = $1 AND p.deleted_at IS NULL
+        GROUP BY p.id, f.created_at
+        ORDER BY f.created_at DESC
+        LIMIT $2 OFFSET $3
+    `, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return nil, err
+	}
+	return posts, attachTags(ctx, db, posts)
+}
+
+// registerFavoriteRoutes registers the routes for saving posts and listing saved posts
+func registerFavoriteRoutes(r *gin.Engine, db *sql.DB) {
+	// Route to save or unsave a post
+	// Browser forms are redirected back, while clients asking for JSON get the new state.
+	r.POST("/post/:id/favorite", requireAuth(), func(c *gin.Context) {
+		postID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+		saved, err := toggleFavorite(c.Request.Context(), db, currentUser(c).ID, postID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+			c.JSON(http.StatusOK, gin.H{"favorited": saved})
+			return
+		}
+		back := c.Request.Referer()
+		if back == "" {
+			back = "/favorites"
+		}
+		c.Redirect(http.StatusFound, back)
+	})
+
+	// Route to list the current user's saved posts
+	r.GET("/favorites", requireAuth(), func(c *gin.Context) {
+		userID := currentUser(c).ID
+		page, perPage := parsePageParams(c)
+
+		total, err := countFavorites(c.Request.Context(), db, userID)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		posts, err := listFavorites(c.Request.Context(), db, userID, perPage, (page-1)*perPage)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		data := pageData(c, page, perPage, total)
+		data["Posts"] = posts
+		data["Favorites"] = true
+		renderTemplate(c, "index.html", data)
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// feedSize is the number of recent posts included in the feed
+const feedSize = 30
+
+// rss is the root element of an RSS 2.0 document
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssChannel describes the feed and holds its items
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssItem is a single post in the feed
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Comments    string  `xml:"comments"`
+	Description string  `xml:"description"`
+	PubDate     string  `xml:"pubDate"`
+	GUID        rssGUID `xml:"guid"`
+}
+
+// rssGUID identifies an item; it is the permanent post URL
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// registerFeedRoutes registers the RSS feed of recent posts
+func registerFeedRoutes(r *gin.Engine, db *sql.DB) {
+	r.GET("/feed.rss", func(c *gin.Context) {
+		posts, err := listPosts(c.Request.Context(), db, postListOptions{Sort: sortNew, Limit: feedSize})
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		feed := rss{
+			Version: "2.0",
+			Channel: rssChannel{
+				Title:         "Hacker News Clone",
+				Link:          absURL(c, "/"),
+				Description:   "Recent posts",
+				LastBuildDate: time.Now().Format(time.RFC1123Z),
+			},
+		}
+		for _, post := range posts {
+			postURL := absURL(c, post.URL())
+			// Text-only posts have no external link, so point readers at the discussion
+			link := post.Link
+			if link == "" {
+				link = postURL
+			}
+			feed.Channel.Items = append(feed.Channel.Items, rssItem{
+				Title:       post.Title,
+				Link:        link,
+				Comments:    postURL,
+				Description: string(renderMarkdown(post.Content)),
+				PubDate:     post.CreatedAt.Format(time.RFC1123Z),
+				GUID:        rssGUID{Value: postURL, IsPermaLink: true},
+			})
+		}
+
+		out, err := xml.MarshalIndent(feed, "", "  ")
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		c.Data(http.StatusOK, "application/rss+xml; charset=utf-8", append([]byte(xml.Header), out...))
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	flagTargetPost    = "post"
+	flagTargetComment = "comment"
+
+	maxFlagReasonLength = 255 // Maximum length of the reason given with a flag
+)
+
+// flagTargetQueries maps each flag target type to a query selecting the target by ID while it is live
+// Deleted posts, dead comments and comments on deleted posts can't be flagged.
+var flagTargetQueries = map[string]string{
+	flagTargetPost:    "SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL",
+	flagTargetComment: "SELECT 1 FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.id = $1 AND c.status = 'live' AND p.deleted_at IS NULL",
+}
+
+// addFlag records a report by a user against a post or comment and returns its number of flags
+// Each user flags a target at most once; repeating it keeps the original flag.
+// Flags on posts are also counted in posts.flag_count so listings can hide them cheaply.
+// It returns sql.ErrNoRows if the target does not exist or is deleted.
+func addFlag(ctx context.Context, db *sql.DB, targetType string, targetID, reporterID int, reason string) (int, error) {
+	var count int
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRowContext(ctx, flagTargetQueries[targetType], targetID).Scan(&exists); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+            INSERT INTO flags (target_type, target_id, reporter, reason, created_at) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+            ON CONFLICT (target_type, target_id, reporter) DO NOTHING
+        `, targetType, targetID, reporterID, reason); err != nil {
+			return err
+		}
+
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM flags WHERE target_type = $1 AND target_id = $2", targetType, targetID).Scan(&count); err != nil {
+			return err
+		}
+		if targetType == flagTargetPost {
+			if _, err := tx.ExecContext(ctx, "UPDATE posts SET flag_count = $1 WHERE id = $2", count, targetID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// registerFlagRoutes registers the routes for reporting posts and comments
+// Browser forms are redirected back to the page they came from, while clients
+// asking for JSON get the target's number of flags.
+func registerFlagRoutes(r *gin.Engine, db *sql.DB) {
+	flag := func(c *gin.Context, targetType string, targetID int) {
+		reason := strings.TrimSpace(c.PostForm("reason"))
+		if len(reason) > maxFlagReasonLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reason must be at most " + strconv.Itoa(maxFlagReasonLength) + " characters"})
+			return
+		}
+		flags, err := addFlag(c.Request.Context(), db, targetType, targetID, currentUser(c).ID, reason)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+			c.JSON(http.StatusOK, gin.H{"flags": flags})
+			return
+		}
+		// Redirect back to the page the flag came from
+		back := c.Request.Referer()
+		if back == "" {
+			back = "/post/" + c.Param("id")
+		}
+		c.Redirect(http.StatusFound, back)
+	}
+
+	// Route to flag a post
+	r.POST("/post/:id/flag", requireAuth(), func(c *gin.Context) {
+		postID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+		flag(c, flagTargetPost, postID)
+	})
+
+	// Route to flag a comment
+	r.POST("/post/:id/comment/:commentID/flag", requireAuth(), func(c *gin.Context) {
+		postID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+		commentID, err := strconv.Atoi(c.Param("commentID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+			return
+		}
+
+		// A comment is only found through the post it belongs to
+		commentPostID, err := getCommentPostID(c.Request.Context(), db, commentID)
+		if err != nil && err != sql.ErrNoRows {
+			serverError(c, err)
+			return
+		}
+		if err == sql.ErrNoRows || commentPostID != postID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return
+		}
+		flag(c, flagTargetComment, commentID)
+	})
+}
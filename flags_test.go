@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestAddFlag(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	alice := testUser(t, db, "alice")
+	bob := testUser(t, db, "bob")
+	live := testPost(t, db, "Live", "", nil)
+	liveComment := testComment(t, db, live, nil)
+	deadComment := testComment(t, db, live, nil)
+	if err := setCommentStatus(ctx, db, deadComment, commentDead); err != nil {
+		t.Fatal(err)
+	}
+	deleted := testPost(t, db, "Deleted", "", nil)
+	orphan := testComment(t, db, deleted, nil)
+	if err := deletePost(ctx, db, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		targetType string
+		targetID   int
+		reporter   int
+		wantErr    error
+		wantFlags  int
+	}{
+		{"live post", flagTargetPost, live, alice, nil, 1},
+		{"repeat flag is kept once", flagTargetPost, live, alice, nil, 1},
+		{"second reporter", flagTargetPost, live, bob, nil, 2},
+		{"deleted post", flagTargetPost, deleted, alice, sql.ErrNoRows, 0},
+		{"missing post", flagTargetPost, deleted + 1, alice, sql.ErrNoRows, 0},
+		{"live comment", flagTargetComment, liveComment, alice, nil, 1},
+		{"dead comment", flagTargetComment, deadComment, alice, sql.ErrNoRows, 0},
+		{"comment on a deleted post", flagTargetComment, orphan, alice, sql.ErrNoRows, 0},
+		{"missing comment", flagTargetComment, orphan + 1, alice, sql.ErrNoRows, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, err := addFlag(ctx, db, tt.targetType, tt.targetID, tt.reporter, "")
+			if err != tt.wantErr {
+				t.Fatalf("addFlag = %v, want %v", err, tt.wantErr)
+			}
+			if flags != tt.wantFlags {
+				t.Errorf("addFlag counted %d flags, want %d", flags, tt.wantFlags)
+			}
+			var stored int
+			if err := db.QueryRow("SELECT COUNT(*) FROM flags WHERE target_type = $1 AND target_id = $2", tt.targetType, tt.targetID).Scan(&stored); err != nil {
+				t.Fatal(err)
+			}
+			if stored != tt.wantFlags {
+				t.Errorf("%d flags stored, want %d", stored, tt.wantFlags)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeAgo(t *testing.T) {
+	// A few seconds of slack keep the cases away from the boundaries while the test runs
+	const slack = 5 * time.Second
+	day := 24 * time.Hour
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{0, "just now"},
+		{time.Minute - slack, "just now"},
+		{time.Minute + slack, "1 minute ago"},
+		{59*time.Minute + slack, "59 minutes ago"},
+		{time.Hour + slack, "1 hour ago"},
+		{23*time.Hour + slack, "23 hours ago"},
+		{day + slack, "yesterday"},
+		{2*day + slack, "2 days ago"},
+		{29*day + slack, "29 days ago"},
+		{30*day + slack, "1 month ago"},
+		{364*day + slack, "12 months ago"},
+		{365*day + slack, "1 year ago"},
+		{3*365*day + slack, "3 years ago"},
+		{-time.Hour, "just now"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := timeAgo(time.Now().Add(-tt.ago)); got != tt.want {
+				t.Errorf("timeAgo(now - %v) = %q, want %q", tt.ago, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{"short enough", "hello world", 20, "hello world"},
+		{"exact length", "hello", 5, "hello"},
+		{"whitespace collapsed", "  hello \n\t world  ", 20, "hello world"},
+		{"cut at a word boundary", "the quick brown fox", 12, "the quick…"},
+		{"punctuation before the cut dropped", "first, second third", 10, "first…"},
+		{"single long word cut mid-word", "supercalifragilistic", 5, "super…"},
+		{"runes, not bytes", "héllo wörld ünïcode", 13, "héllo wörld…"},
+		{"empty", "", 10, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate(tt.s, tt.n); got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+			}
+		})
+	}
+}
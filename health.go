@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds the database ping performed by the readiness probe
+const readinessTimeout = 2 * time.Second
+
+// Build information, set at build time with
+// -ldflags "-X main.Version=... -X main.Commit=... -X main.BuildTime=..."
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// startTime is when the process started, for the uptime reported by /version
+var startTime = time.Now()
+
+// healthPaths are the probe routes excluded from request logging
+var healthPaths = []string{"/healthz", "/readyz"}
+
+// registerHealthRoutes registers the liveness and readiness probes
+func registerHealthRoutes(r *gin.Engine, db *sql.DB) {
+	// Liveness probe: the process is up and serving requests
+	r.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// Readiness probe: the database is reachable
+	r.GET("/readyz", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+		defer cancel()
+		if err := db.PingContext(ctx); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "database unreachable"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+}
+
+// registerVersionRoute registers the build information route
+// Unlike the probes it is meant to sit behind the site credentials.
+func registerVersionRoute(r *gin.Engine, db *sql.DB) {
+	// Route to report the running build, its uptime and whether the database is reachable
+	// It always answers 200 so the build can be checked even while the database is down.
+	r.GET("/version", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+		defer cancel()
+		database := "ok"
+		if err := db.PingContext(ctx); err != nil {
+			database = "unreachable"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"version":        Version,
+			"commit":         Commit,
+			"build_time":     BuildTime,
+			"uptime_seconds": int(time.Since(startTime).Seconds()),
+			"database":       database,
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImageDimension is the largest accepted width or height of a post image in pixels
+const maxImageDimension = 4096
+
+// imageTypes maps the accepted image content types to the extension they are stored with
+var imageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+// readImage reads and checks an uploaded post image
+// The content type is sniffed from the bytes rather than trusted from the
+// upload, and the image header is decoded to check its dimensions. It returns
+// the image and the extension for its type, or an error fit to show the user.
+func readImage(fh *multipart.FileHeader, maxSize int64) ([]byte, string, error) {
+	tooLarge := fmt.Errorf("image must be at most %d KB", maxSize/1024)
+	if fh.Size > maxSize {
+		return nil, "", tooLarge
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, "", errors.New("image could not be read")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return nil, "", errors.New("image could not be read")
+	}
+	if int64(len(data)) > maxSize {
+		return nil, "", tooLarge
+	}
+
+	ext, ok := imageTypes[http.DetectContentType(data)]
+	if !ok {
+		return nil, "", errors.New("image must be a PNG, JPEG or GIF file")
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errors.New("image file is damaged or incomplete")
+	}
+	if cfg.Width > maxImageDimension || cfg.Height > maxImageDimension {
+		return nil, "", fmt.Errorf("image must be at most %dx%d pixels", maxImageDimension, maxImageDimension)
+	}
+	return data, ext, nil
+}
+
+// imageStore keeps post images in a directory, or in the post_images table when dir is empty
+type imageStore struct {
+	dir string
+}
+
+// save stores the image of a post and records its file name on the post within tx
+// It runs in the transaction inserting the post, so a failed save leaves no post behind.
+func (s imageStore) save(ctx context.Context, tx *sql.Tx, postID int, ext string, data []byte) error {
+	name := strconv.Itoa(postID) + ext
+	if _, err := tx.ExecContext(ctx, "UPDATE posts SET image_path = $1 WHERE id = $2", name, postID); err != nil {
+		return err
+	}
+	if s.dir != "" {
+		return os.WriteFile(filepath.Join(s.dir, name), data, 0o644)
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO post_images (post_id, data) VALUES ($1, $2)", postID, data)
+	return err
+}
+
+// load returns the stored image of a post
+func (s imageStore) load(ctx context.Context, db *sql.DB, postID int, name string) ([]byte, error) {
+	if s.dir != "" {
+		return os.ReadFile(filepath.Join(s.dir, name))
+	}
+	var data []byte
+	err := db.QueryRowContext(ctx, "SELECT data FROM post_images WHERE post_id = $1", postID).Scan(&data)
+	return data, err
+}
+
+// registerImageRoutes registers the route serving post images
+func registerImageRoutes(r *gin.Engine, db *sql.DB, images imageStore) {
+	// Route to serve the image of a post
+	// Images never change once uploaded, so browsers may cache them like static files.
+	r.GET("/post/:id/image", func(c *gin.Context) {
+		id := postIDParam(c)
+		var name string
+		err := db.QueryRowContext(c.Request.Context(), "SELECT image_path FROM posts WHERE id = $1 AND deleted_at IS NULL", id).Scan(&name)
+		if err != nil && err != sql.ErrNoRows {
+			serverError(c, err)
+			return
+		}
+		if name == "" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		data, err := images.load(c.Request.Context(), db, id, name)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		contentType := "application/octet-stream"
+		for t, ext := range imageTypes {
+			if path.Ext(name) == ext {
+				contentType = t
+			}
+		}
+		c.Header("Cache-Control", "public, max-age="+staticMaxAge)
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Data(http.StatusOK, contentType, data)
+	})
+}
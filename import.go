@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// importPost is a post in the JSON array accepted by POST /api/import
+type importPost struct {
+	Title    string          `json:"title"`
+	Link     string          `json:"link"`
+	Content  string          `json:"content"`
+	Tags     []string        `json:"tags"`
+	Author   string          `json:"author"`
+	Comments []importComment `json:"comments"`
+}
+
+// importComment is a comment of an imported post, with its replies nested under it
+type importComment struct {
+	Content string          `json:"content"`
+	Author  string          `json:"author"`
+	Replies []importComment `json:"replies"`
+}
+
+// importSummary reports how many rows an import inserted
+type importSummary struct {
+	Posts    int `json:"posts"`
+	Comments int `json:"comments"`
+}
+
+// prepareImport validates the records of an import and normalizes them in place
+// Records are checked like submissions from the form, missing display names
+// become anonymousAuthor, and replies may nest at most maxDepth levels deep.
+// The error names the offending record, e.g.
+// "posts[2].comments[0]: Comment can't be empty".
+func prepareImport(posts []importPost, maxDepth int) error {
+	for i := range posts {
+		p := &posts[i]
+		where := fmt.Sprintf("posts[%d]", i)
+		p.Title = strings.TrimSpace(p.Title)
+		if errs := validatePost(p.Title, p.Link, p.Content); errs != nil {
+			return fmt.Errorf("%s: %s", where, errs[0].Message)
+		}
+		link, err := validateLink(p.Link)
+		if err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+		p.Link = link
+		if p.Tags, err = parseTags(strings.Join(p.Tags, ",")); err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+		if p.Author = cleanAuthor(p.Author); p.Author == "" {
+			p.Author = anonymousAuthor
+		}
+		if err := prepareImportComments(p.Comments, where+".comments", 1, maxDepth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareImportComments validates comments at depth and, recursively, their replies
+func prepareImportComments(comments []importComment, where string, depth, maxDepth int) error {
+	for i := range comments {
+		cm := &comments[i]
+		at := fmt.Sprintf("%s[%d]", where, i)
+		if depth > maxDepth {
+			return fmt.Errorf("%s: replies may nest at most %d levels deep", at, maxDepth)
+		}
+		if errs := validateComment(cm.Content); errs != nil {
+			return fmt.Errorf("%s: %s", at, errs[0].Message)
+		}
+		if cm.Author = cleanAuthor(cm.Author); cm.Author == "" {
+			cm.Author = anonymousAuthor
+		}
+		if err := prepareImportComments(cm.Replies, at+".replies", depth+1, maxDepth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importPosts inserts validated posts with their comments in a single transaction
+// Imported content has no author account, only the display names given. If
+// any insert fails the whole import is rolled back.
+func importPosts(ctx context.Context, db *sql.DB, posts []importPost) (importSummary, error) {
+	var summary importSummary
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		for _, p := range posts {
+			id, err := insertPost(ctx, tx, p.Title, p.Content, p.Link, p.Tags, nil, p.Author)
+			if err != nil {
+				return err
+			}
+			summary.Posts++
+			n, err := insertImportComments(ctx, tx, id, nil, p.Comments)
+			if err != nil {
+				return err
+			}
+			summary.Comments += n
+		}
+		return nil
+	})
+	if err != nil {
+		return importSummary{}, err
+	}
+	return summary, nil
+}
+
+// insertImportComments inserts comments under parentID and their replies, returning how many were inserted
+func insertImportComments(ctx context.Context, tx *sql.Tx, postID int, parentID *int, comments []importComment) (int, error) {
+	count := 0
+	for _, cm := range comments {
+		var id int
+		if err := tx.QueryRowContext(ctx, "INSERT INTO comments (content, post_id, parent_id, author, created_at, updated_at) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) RETURNING id",
+			sanitizeContent(cm.Content), postID, parentID, cm.Author).Scan(&id); err != nil {
+			return 0, err
+		}
+		n, err := insertImportComments(ctx, tx, postID, &id, cm.Replies)
+		if err != nil {
+			return 0, err
+		}
+		count += 1 + n
+	}
+	return count, nil
+}
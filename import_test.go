@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPrepareImport(t *testing.T) {
+	ok := func() importPost { return importPost{Title: "A post", Link: "https://example.com/a"} }
+	reply := func(replies ...importComment) importComment {
+		return importComment{Content: "a reply", Replies: replies}
+	}
+	tooManyTags := make([]string, maxTagsPerPost+1)
+	for i := range tooManyTags {
+		tooManyTags[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(p *importPost)
+		wantErr string // Empty when the import is valid
+	}{
+		{"valid", func(p *importPost) {}, ""},
+		{"title only whitespace", func(p *importPost) { p.Title = "  " }, "posts[1]: Title is required"},
+		{"no link or content", func(p *importPost) { p.Link = "" }, "posts[1]: Add a link or some text"},
+		{"bad link", func(p *importPost) { p.Link = "ftp://example.com/a" }, "posts[1]: link must start with http:// or https://"},
+		{"tag too long", func(p *importPost) { p.Tags = []string{strings.Repeat("x", maxTagLength+1)} }, "posts[1]: tags must be at most"},
+		{"too many tags", func(p *importPost) { p.Tags = tooManyTags }, "posts[1]: a post can have at most"},
+		{"empty comment", func(p *importPost) {
+			p.Comments = []importComment{{Content: "fine"}, {Content: " \n"}}
+		}, "posts[1].comments[1]: Comment can't be empty"},
+		{"empty reply", func(p *importPost) {
+			p.Comments = []importComment{{Content: "fine", Replies: []importComment{{}}}}
+		}, "posts[1].comments[0].replies[0]: Comment can't be empty"},
+		{"replies at the deepest level", func(p *importPost) {
+			p.Comments = []importComment{reply(reply(reply()))}
+		}, ""},
+		{"replies too deep", func(p *importPost) {
+			p.Comments = []importComment{reply(reply(reply(reply())))}
+		}, "posts[1].comments[0].replies[0].replies[0].replies[0]: replies may nest at most 3 levels deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts := []importPost{ok(), ok()}
+			tt.edit(&posts[1])
+			err := prepareImport(posts, 3)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("prepareImport = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Fatalf("prepareImport = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrepareImportNormalizes(t *testing.T) {
+	posts := []importPost{{
+		Title:    "  Padded title ",
+		Link:     "HTTP://WWW.Example.com/a/?utm_source=feed",
+		Tags:     []string{" Go", "go", "", "Web "},
+		Author:   "   ",
+		Comments: []importComment{{Content: "first", Author: " bob ", Replies: []importComment{{Content: "reply"}}}},
+	}}
+	if err := prepareImport(posts, 3); err != nil {
+		t.Fatal(err)
+	}
+	p := posts[0]
+	if p.Title != "Padded title" {
+		t.Errorf("title = %q, want %q", p.Title, "Padded title")
+	}
+	if want, _ := validateLink("HTTP://WWW.Example.com/a/?utm_source=feed"); p.Link != want {
+		t.Errorf("link = %q, want %q", p.Link, want)
+	}
+	if got := strings.Join(p.Tags, ","); got != "go,web" {
+		t.Errorf("tags = %q, want %q", got, "go,web")
+	}
+	if p.Author != anonymousAuthor {
+		t.Errorf("post author = %q, want %q", p.Author, anonymousAuthor)
+	}
+	if a := p.Comments[0].Author; a != "bob" {
+		t.Errorf("comment author = %q, want %q", a, "bob")
+	}
+	if a := p.Comments[0].Replies[0].Author; a != anonymousAuthor {
+		t.Errorf("reply author = %q, want %q", a, anonymousAuthor)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strings"
+)
+
+// trackingParams lists query parameters that only identify where a visitor came from
+// Parameters starting with "utm_" are dropped as well.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"igshid":  true,
+	"ref_src": true,
+}
+
+// normalizeURL reduces a submitted link to the key duplicate submissions are detected by
+// The scheme, fragment, tracking parameters, a leading "www." and trailing
+// slashes are dropped and the remaining query parameters are sorted, so
+// https://www.example.com/a/?utm_source=x and http://example.com/a map to the
+// same key. The result is only compared, never shown or followed.
+func normalizeURL(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := normalizeHost(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	query := u.Query()
+	for key := range query {
+		if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+
+	key := host + strings.TrimRight(u.EscapedPath(), "/")
+	if len(query) > 0 {
+		key += "?" + query.Encode()
+	}
+	return key
+}
+
+// findPostByLink returns the ID of a live post whose link normalizes to the same key as link
+// It returns sql.ErrNoRows if the link has not been submitted before.
+func findPostByLink(ctx context.Context, db *sql.DB, link string) (int, error) {
+	var id int
+	err := db.QueryRowContext(ctx, "SELECT id FROM posts WHERE link_key = $1 AND deleted_at IS NULL ORDER BY created_at LIMIT 1",
+		normalizeURL(link)).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{"plain", "https://example.com/a", "example.com/a"},
+		{"scheme ignored", "http://example.com/a", "example.com/a"},
+		{"www dropped", "https://www.example.com/a", "example.com/a"},
+		{"host case folded", "https://EXAMPLE.com/a", "example.com/a"},
+		{"path case kept", "https://example.com/A", "example.com/A"},
+		{"trailing slashes dropped", "https://example.com/a//", "example.com/a"},
+		{"root", "https://example.com/", "example.com"},
+		{"fragment dropped", "https://example.com/a#section", "example.com/a"},
+		{"tracking parameters dropped", "https://example.com/a?utm_source=x&UTM_Medium=y&fbclid=z&gclid=w", "example.com/a"},
+		{"other parameters sorted", "https://example.com/a?b=2&a=1&utm_campaign=x", "example.com/a?a=1&b=2"},
+		{"default ports dropped", "https://example.com:443/a", "example.com/a"},
+		{"other ports kept", "https://example.com:8080/a", "example.com:8080/a"},
+		{"surrounding spaces", "  https://example.com/a  ", "example.com/a"},
+		{"no host", "/relative/path", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeURL(tt.link); got != tt.want {
+				t.Errorf("normalizeURL(%q) = %q, want %q", tt.link, got, tt.want)
+			}
+		})
+	}
+}
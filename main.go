@@ -1,259 +1,941 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
-	"fmt"
-	"html/template"
-	"log"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"math"
 	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 // Post represents a post in the Hacker News clone
 type Post struct {
-	ID           int
-	Title        string
-	Link         string
-	Host         string
-	Content      string
-	CreatedAt    time.Time
-	CommentCount int
-	Comments     []Comment
+	ID           int       `json:"id"`
+	Title        string    `json:"title"`
+	Slug         string    `json:"slug"`
+	Type         string    `json:"type"` // postTypeLink or postTypeText
+	Link         string    `json:"link"`
+	Host         string    `json:"host"`
+	Content      string    `json:"content"`
+	Points       int       `json:"points"`
+	AuthorID     *int      `json:"author_id"`
+	Author       string    `json:"author"` // Display name given at submission
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"` // Time of the last edit, equal to CreatedAt until then
+	Tags         []string  `json:"tags"`
+	CommentCount int       `json:"comment_count"`
+	Comments     []Comment `json:"comments,omitempty"`
+	Version      int       `json:"version"` // Incremented on every edit
+	Pinned       bool      `json:"pinned"`  // Kept at the top of the front page by an admin
+	ImagePath    string    `json:"-"`       // File name of the uploaded image, empty without one
 }
 
+// postEditGrace is how soon after creation an edit still counts as part of the original post
+const postEditGrace = time.Minute
+
+// Edited reports whether the post was changed after it was created, ignoring quick fixes within postEditGrace
+func (p Post) Edited() bool {
+	return p.UpdatedAt.Sub(p.CreatedAt) > postEditGrace
+}
+
+// Post types: link posts point at an external page, text posts only have content
+const (
+	postTypeLink = "link"
+	postTypeText = "text"
+)
+
 // Comment represents a comment on a post
 type Comment struct {
-	ID        int
-	Content   string
-	PostID    int
-	CreatedAt time.Time
+	ID        int        `json:"id"`
+	Content   string     `json:"content"`
+	PostID    int        `json:"post_id"`
+	ParentID  *int       `json:"parent_id"`
+	AuthorID  *int       `json:"author_id"`
+	Author    string     `json:"author"` // Display name given at submission
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at"`
+	Status    string     `json:"status"` // commentLive or commentDead
+	Replies   []Comment  `json:"replies,omitempty"`
 }
 
-// createTable encapsulates the logic to create a table
-// It checks if the table exists and creates it if not.
-func createTable(db *sql.DB, tableName, createQuery string) error {
-	var exists bool
-	// SQL query to check if the table exists in the 'public' schema
-	err := db.QueryRow(`
-        SELECT EXISTS (
-            SELECT FROM information_schema.tables 
-            WHERE table_schema = 'public' 
-            AND table_name = $1
-        );
-    `, tableName).Scan(&exists)
-	if err != nil {
-		return err
+const (
+	commentLive = "live"
+	commentDead = "dead" // Hidden by a moderator; shown as a placeholder
+)
+
+// ogDescriptionLength is the longest post excerpt used in link previews
+const ogDescriptionLength = 200
+
+// shutdownTimeout bounds how long in-flight requests may take to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// Pagination defaults for post listings
+const (
+	defaultPerPage = 30
+	maxPerPage     = 100
+)
+
+// notices are the messages the front page can show through ?notice=<key>
+// Only keys are accepted so the query string can't inject arbitrary text.
+var notices = map[string]string{
+	noticeNoPosts: "There are no posts yet, so there is nothing random to show.",
+}
+
+const noticeNoPosts = "no-posts"
+
+// postIDParam returns the numeric ':id' route parameter
+// A missing or malformed ID yields 0, which matches no post, so lookups report it as not found.
+func postIDParam(c *gin.Context) int {
+	id, _ := strconv.Atoi(c.Param("id"))
+	return id
+}
+
+// nextPath returns the path in the 'next' form field to redirect to after an action
+// Anything but a local path falls back to fallback so the field cannot send users off-site.
+func nextPath(c *gin.Context, fallback string) string {
+	next := c.PostForm("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return fallback
 	}
-	if !exists {
-		// Create the table if it doesn't exist
-		_, err := db.Exec(createQuery)
-		if err != nil {
-			return err
-		}
-		fmt.Printf("%s table created.\n", tableName)
+	return next
+}
+
+// parsePageParams reads the 'page' and 'per_page' query parameters
+// Invalid or non-positive values fall back to the defaults, and per_page is clamped to maxPerPage.
+func parsePageParams(c *gin.Context) (page, perPage int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err = strconv.Atoi(c.Query("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	return page, perPage
+}
+
+// pageData builds the template values for page navigation
+// The Previous/Next URLs keep the current path and query string, only replacing the page number.
+func pageData(c *gin.Context, page, perPage, total int) map[string]interface{} {
+	totalPages := (total + perPage - 1) / perPage
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	pageURL := func(n int) string {
+		q := c.Request.URL.Query()
+		q.Set("page", strconv.Itoa(n))
+		q.Set("per_page", strconv.Itoa(perPage))
+		return c.Request.URL.Path + "?" + q.Encode()
+	}
+	return map[string]interface{}{
+		"Page":       page,
+		"PerPage":    perPage,
+		"Total":      total,
+		"TotalPages": totalPages,
+		"HasPrev":    page > 1,
+		"HasNext":    page < totalPages,
+		"PrevURL":    pageURL(page - 1),
+		"NextURL":    pageURL(page + 1),
 	}
-	return nil
 }
 
-// createTables creates all necessary tables
-func createTables(db *sql.DB) error {
-	// SQL query to create the 'posts' table
-	postsTableQuery := `
-        CREATE TABLE posts (
-            id SERIAL PRIMARY KEY, -- Auto - incrementing primary key
-            title VARCHAR(255) NOT NULL, -- Post title
-            link VARCHAR(255) NOT NULL DEFAULT '', -- Post link
-            content TEXT NOT NULL, -- Post content
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- Creation time
-        );
-    `
-	// SQL query to create the 'comments' table
-	commentsTableQuery := `
-        CREATE TABLE comments (
-            id SERIAL PRIMARY KEY, -- Auto - incrementing primary key
-            content TEXT NOT NULL, -- Comment content
-            post_id INTEGER NOT NULL, -- ID of the related post
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Creation time
-            FOREIGN KEY (post_id) REFERENCES posts(id) -- Foreign key referencing 'posts' table
-        );
-    `
-	if err := createTable(db, "posts", postsTableQuery); err != nil {
-		return err
+// commentPageData builds the template values for navigating the comment pages of a post
+// It mirrors pageData but uses the 'cpage' query parameter so it can't clash with post listings.
+func commentPageData(c *gin.Context, page, totalPages int) map[string]interface{} {
+	pageURL := func(n int) string {
+		q := c.Request.URL.Query()
+		q.Set("cpage", strconv.Itoa(n))
+		return c.Request.URL.Path + "?" + q.Encode()
 	}
-	if err := createTable(db, "comments", commentsTableQuery); err != nil {
-		return err
+	return map[string]interface{}{
+		"Page":       page,
+		"TotalPages": totalPages,
+		"HasPrev":    page > 1,
+		"HasNext":    page < totalPages,
+		"PrevURL":    pageURL(page - 1),
+		"NextURL":    pageURL(page + 1),
 	}
-	return nil
 }
 
 // renderTemplate encapsulates the template rendering logic
-func renderTemplate(c *gin.Context, tmplPath string, data interface{}) {
-	tmpl, err := template.ParseFiles(tmplPath)
+// The page is rendered into a buffer first so a template error can still
+// produce a clean error page instead of a half-written response.
+func renderTemplate(c *gin.Context, name string, data interface{}) {
+	tmpl, err := lookupTemplate(name)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.Error("Cannot load template", "template", name, "error", err)
+		renderServerError(c)
 		return
 	}
-	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := tmpl.Execute(c.Writer, data); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Make the logged-in user, CSRF token and base URL available to every page
+	if m, ok := data.(map[string]interface{}); ok {
+		m["CurrentUser"] = currentUser(c)
+		m["CSRFToken"] = csrfToken(c)
+		m["BaseURL"] = baseURL(c)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		slog.Error("Cannot render template", "template", name, "error", err)
+		renderServerError(c)
+		return
+	}
+	c.Data(c.Writer.Status(), "text/html; charset=utf-8", buf.Bytes())
+}
+
+// renderNotFound renders the friendly 404 page with a short explanation
+func renderNotFound(c *gin.Context, message string) {
+	c.Status(http.StatusNotFound)
+	renderTemplate(c, "404.html", map[string]interface{}{
+		"Message": message,
+	})
+}
+
+// renderServerError renders the friendly 500 page
+// The caller is responsible for logging the underlying error; nothing about it is shown to the user.
+func renderServerError(c *gin.Context) {
+	var buf bytes.Buffer
+	if tmpl, err := lookupTemplate("500.html"); err == nil && tmpl.Execute(&buf, map[string]interface{}{"RequestID": getRequestID(c)}) == nil {
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", buf.Bytes())
+		return
 	}
+	c.String(http.StatusInternalServerError, "Internal Server Error")
 }
 
 func main() {
-	// Database connection configuration
-	// Use DSN from environment variable
-	dsn := os.Getenv("PG_DSN")
-	// Connect to the database using DSN
-	db, err := sql.Open("postgres", dsn)
+	// Cancelled on SIGINT/SIGTERM to stop the server and background goroutines
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Load configuration from environment variables
+	cfg, err := LoadConfig()
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	logger := newLogger(cfg.LogLevel)
+	slog.SetDefault(logger)
+
+	// Connect to the database using the configured driver and DSN
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		fatal("Cannot open database", err)
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	// sql.Open does not connect, so wait until the database answers before migrating
+	if err := waitForDB(ctx, db, cfg.ConnectAttempts, cfg.ConnectTimeout); err != nil {
+		fatal("Cannot connect to database", err)
+	}
+
+	// Apply pending schema migrations
+	if err := migrate(ctx, db); err != nil {
+		fatal("Cannot migrate database", err)
+	}
+
+	// Parse templates up front so a broken template fails at startup
+	assets := assetFS(cfg.DevMode)
+	templates, err = parseTemplates(assets)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Cannot parse templates", err)
+	}
+	if cfg.DevMode {
+		devTemplates = assets
 	}
-	defer db.Close()
+	siteBaseURL = cfg.BaseURL
+	countDeadComments = cfg.CountDeadComments
+	if cfg.SpamKeywords != nil {
+		spamKeywords = cfg.SpamKeywords
+	}
+
+	// Set up Gin router with structured request logging
+	r := gin.New()
 
-	// Create tables if they don't exist
-	if err := createTables(db); err != nil {
-		log.Fatal(err)
+	// Only believe forwarding headers from the configured proxies
+	// c.ClientIP, which the rate limiter, anonymous votes and request logs rely
+	// on, reads X-Forwarded-For only when the connection comes from one of them.
+	// Trusting a range that ordinary clients can connect from would let them
+	// pick any IP they like and slip past the rate limiter.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fatal("Invalid configuration", err)
 	}
+	if trustedProxies, err = parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		fatal("Invalid configuration", err)
+	}
+	r.Use(assignRequestID(), requestLogger(logger), recoverPanics())
+
+	// Prometheus metrics for requests and the connection pool
+	m := newMetrics()
+	go m.runDBStats(ctx, db)
+	r.Use(m.middleware())
+
+	// Compress text responses for clients that accept gzip
+	r.Use(gzipResponses())
+
+	// Health probes for load balancers and orchestrators, reachable without site credentials
+	registerHealthRoutes(r, db)
 
-	// Set up Gin router
-	r := gin.Default()
+	// Gate everything below behind Basic Auth on private deployments
+	r.Use(siteBasicAuth(cfg.SiteUser, cfg.SitePass))
+
+	// Metrics and build information, which private deployments keep private too
+	r.GET("/metrics", m.handler())
+	registerVersionRoute(r, db)
 
 	// Serve static files
-	r.Static("/static", "./static")
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		fatal("Cannot load static files", err)
+	}
+	registerStaticRoutes(r, static, cfg.DevMode)
+
+	// Keep the stored hot scores decaying with post age
+	go runHotScores(ctx, db, cfg.HotScoreInterval)
+
+	// Keep uploaded post images in IMAGE_DIR, or in the database without one
+	images := imageStore{dir: cfg.ImageDir}
+	if cfg.ImageDir != "" {
+		if err := os.MkdirAll(cfg.ImageDir, 0o755); err != nil {
+			fatal("Cannot create image directory", err)
+		}
+	}
+
+	// Email post authors about new comments in the background
+	mailer := newNotifier(cfg)
+	go mailer.run(ctx)
+
+	// Throttle state-changing requests per client IP
+	limiter := newRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst)
+	go limiter.runCleanup(ctx)
+	r.Use(limiter.middleware())
+
+	// Space out comments from the same user or IP
+	commentWait := newCooldown(cfg.CommentCooldown)
+	go commentWait.runCleanup(ctx)
+
+	// Cap request bodies before anything below reads them
+	r.Use(limitRequestBody(cfg.MaxBodySize, map[string]int64{
+		"/new": cfg.MaxBodySize + cfg.MaxImageSize,
+	}))
+
+	// Require a CSRF token on form submissions
+	r.Use(csrfProtect())
+
+	// Bound the database work of every request below this point
+	r.Use(queryTimeout(cfg.QueryTimeout))
+
+	// Load the logged-in user for every request
+	r.Use(loadUser(db))
+
+	// Cache front page listings briefly, dropping them whenever something changes
+	homepage := newHomepageCache(cfg.HomepageCacheTTL)
+	r.Use(homepage.invalidateOnWrite())
 
 	// Define routes
-	// Route to display the list of posts
-	r.GET("/", func(c *gin.Context) {
-		// SQL query to select posts ordered by creation time in descending order
-		rows, err := db.Query("SELECT id, title, link, content, created_at FROM posts ORDER BY created_at DESC")
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		defer rows.Close()
-
-		var posts []Post
-		for rows.Next() {
-			var post Post
-			if err := rows.Scan(
-				&post.ID,
-				&post.Title,
-				&post.Link,
-				&post.Content,
-				&post.CreatedAt,
-			); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// frontPage renders a page of the front page listing in the given order
+	frontPage := func(c *gin.Context, sort string) {
+		page, perPage := parsePageParams(c)
+
+		// Count all posts for the page navigation, unless the page is cached
+		opts := postListOptions{Sort: sort, MaxFlags: cfg.FlagThreshold, MaxPerHost: cfg.MaxPostsPerDomain, PinnedFirst: true, Limit: perPage, Offset: (page - 1) * perPage}
+		key := homepageKey{sort: opts.Sort, limit: opts.Limit, offset: opts.Offset}
+		cached, ok := homepage.get(key)
+		if !ok {
+			var err error
+			if cached.total, err = countPosts(c.Request.Context(), db, opts); err != nil {
+				serverError(c, err)
 				return
 			}
-			u, _ := url.Parse(post.Link)
-			post.Host = u.Host
-
-			// SQL query to count comments for each post
-			var commentCount int
-			if err := db.QueryRow("SELECT COUNT(*) FROM comments WHERE post_id = $1", post.ID).Scan(&commentCount); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			if cached.posts, err = listPosts(c.Request.Context(), db, opts); err != nil {
+				serverError(c, err)
 				return
 			}
-			post.CommentCount = commentCount
+			homepage.set(key, cached.posts, cached.total)
+		}
+
+		data := pageData(c, page, perPage, cached.total)
+		data["Posts"] = cached.posts
+		data["Sort"] = opts.Sort
+		data["Newest"] = c.FullPath() == "/newest"
+		data["Notice"] = notices[c.Query("notice")]
+		renderTemplate(c, "index.html", data)
+	}
+
+	// Route to display the ranked front page, or another order given by ?sort
+	r.GET("/", func(c *gin.Context) {
+		frontPage(c, parseSort(c.Query("sort")))
+	})
+
+	// Route to display all posts newest first, like HN's /newest
+	r.GET("/newest", func(c *gin.Context) {
+		frontPage(c, sortNew)
+	})
 
-			posts = append(posts, post)
+	// Route to search posts by title and content
+	r.GET("/search", func(c *gin.Context) {
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			c.Redirect(http.StatusFound, "/")
+			return
 		}
-		if err := rows.Err(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		page, perPage := parsePageParams(c)
+
+		total, err := countSearchResults(c.Request.Context(), db, query)
+		if err != nil {
+			serverError(c, err)
 			return
 		}
 
-		renderTemplate(c, "templates/index.html", map[string]interface{}{
-			"Posts": posts,
+		posts, err := searchPosts(c.Request.Context(), db, query, perPage, (page-1)*perPage)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		data := pageData(c, page, perPage, total)
+		data["Posts"] = posts
+		data["Query"] = query
+		renderTemplate(c, "index.html", data)
+	})
+
+	// Route to display the new post form
+	// The form can be pre-filled with ?url= and ?title=, which the bookmarklet uses
+	// to submit the page being viewed. An invalid url is dropped rather than reported.
+	r.GET("/new", requireAuth(), func(c *gin.Context) {
+		link, err := validateLink(c.Query("url"))
+		if err != nil {
+			link = ""
+		}
+		renderTemplate(c, "new_post.html", map[string]interface{}{
+			"Form": map[string]string{
+				"Title": cleanTitle(c.Query("title")),
+				"Link":  link,
+			},
 		})
 	})
 
 	// Route to add a new post
-	r.POST("/new", func(c *gin.Context) {
-		title := c.PostForm("title")
+	r.POST("/new", requireAuth(), func(c *gin.Context) {
+		title := strings.TrimSpace(c.PostForm("title"))
 		content := c.PostForm("content")
-		link := c.PostForm("link")
-		// SQL query to insert a new post into the 'posts' table
-		if _, err := db.Exec("INSERT INTO posts (title, content, link, created_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP)",
-			title, content, link); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		link, tags, errs := checkSubmission(title, c.PostForm("link"), content, c.PostForm("tags"))
+		// The image is optional and only sent by the multipart form
+		var imageData []byte
+		var imageExt string
+		if fh, err := c.FormFile("image"); err == nil {
+			if imageData, imageExt, err = readImage(fh, cfg.MaxImageSize); err != nil {
+				errs = append(errs, fieldError{"image", err.Error()})
+			}
+		} else if err != http.ErrMissingFile && err != http.ErrNotMultipart {
+			errs = append(errs, fieldError{"image", "image could not be read"})
+		}
+		// Show the form again with the errors next to their fields and the input kept
+		rejectPost := func(errs fieldErrors) {
+			c.Status(http.StatusBadRequest)
+			renderTemplate(c, "new_post.html", map[string]interface{}{
+				"FieldErrors": errs.Map(),
+				"Form": map[string]string{
+					"Title":   title,
+					"Link":    c.PostForm("link"),
+					"Content": content,
+					"Tags":    c.PostForm("tags"),
+					"Author":  c.PostForm("author"),
+				},
+			})
+		}
+		if errs != nil {
+			rejectPost(errs)
+			return
+		}
+		var attach func(tx *sql.Tx, postID int) error
+		if imageData != nil {
+			attach = func(tx *sql.Tx, postID int) error {
+				return images.save(c.Request.Context(), tx, postID, imageExt, imageData)
+			}
+		}
+		postID, created, err := submitPost(c.Request.Context(), db, title, content, link, tags, currentUserID(c), authorName(c, c.PostForm("author")), voterKey(c), cfg.PointsFloor, attach)
+		if err == errAlreadySubmitted {
+			// The upvote cannot carry the image, so ask rather than drop it silently
+			rejectPost(fieldErrors{{"image", "This link was already submitted, so the image can't be added. Submit again without the image to upvote the existing post."}})
+			return
+		}
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		if !created {
+			c.Redirect(http.StatusFound, "/post/"+strconv.Itoa(postID))
 			return
 		}
 		c.Redirect(http.StatusFound, "/")
 	})
 
+	// renderPost renders the detail page of post with the requested page of its comments
+	// extra adds template data such as the errors and input of a rejected comment.
+	renderPost := func(c *gin.Context, post *Post, extra map[string]interface{}) {
+		roots, err := countRootComments(c.Request.Context(), db, post.ID)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		// Requests past the last page show the last page instead of an empty one
+		totalPages := (roots + cfg.CommentsPerPage - 1) / cfg.CommentsPerPage
+		if totalPages < 1 {
+			totalPages = 1
+		}
+		page, err := strconv.Atoi(c.Query("cpage"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		if page > totalPages {
+			page = totalPages
+		}
+
+		commentSort := parseCommentSort(c.Query("comments"))
+		comments, err := listCommentPage(c.Request.Context(), db, post.ID, commentSort, cfg.CommentsPerPage, (page-1)*cfg.CommentsPerPage)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		post.Comments = buildCommentTree(comments)
+
+		favorited := false
+		if user := currentUser(c); user != nil {
+			if favorited, err = isFavorite(c.Request.Context(), db, user.ID, post.ID); err != nil {
+				serverError(c, err)
+				return
+			}
+		}
+
+		related, err := listRelatedPosts(c.Request.Context(), db, post, relatedPostsLimit, cfg.FlagThreshold)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		data := map[string]interface{}{
+			"Post":        post,
+			"Related":     related,
+			"Description": truncate(post.Content, ogDescriptionLength),
+			"Favorited":   favorited,
+			"CanEdit":     canModify(c, post.AuthorID, cfg.AdminUsers),
+			"CommentSort": commentSort,
+			"CommentPage": commentPageData(c, page, totalPages),
+			"EditCutoff":  time.Now().UTC().Add(-cfg.CommentEditWindow),
+		}
+		for k, v := range extra {
+			data[k] = v
+		}
+		renderTemplate(c, "post_detail.html", data)
+	}
+
 	// Route to display a single post and its comments
-	r.GET("/post/:id", func(c *gin.Context) {
-		id := c.Param("id")
-		var post Post
-		// SQL query to select a single post by ID
-		if err := db.QueryRow("SELECT id, title, link, content, created_at FROM posts WHERE id = $1", id).Scan(
-			&post.ID,
-			&post.Title,
-			&post.Link,
-			&post.Content,
-			&post.CreatedAt,
-		); err != nil {
+	// Posts are looked up by ID alone; a missing or outdated slug is redirected
+	// to the canonical URL so old /post/:id links keep working.
+	showPost := func(c *gin.Context) {
+		post, err := getPostByID(c.Request.Context(), db, postIDParam(c))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				renderNotFound(c, "That post doesn't exist or has been deleted.")
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		if c.Param("slug") != post.Slug {
+			target := post.URL()
+			if c.Request.URL.RawQuery != "" {
+				target += "?" + c.Request.URL.RawQuery
+			}
+			c.Redirect(http.StatusMovedPermanently, target)
+			return
+		}
+
+		// Anonymous visitors all see the same page, so they can revalidate a cached copy
+		// Logged-in pages show votes, favorites and forms for that user and are always rendered.
+		if currentUser(c) == nil {
+			lastComment, err := lastCommentChange(c.Request.Context(), db, post.ID)
+			if err != nil {
+				serverError(c, err)
+				return
+			}
+			if modified, etag := postValidators(post, lastComment); notModified(c, modified, etag) {
+				c.Status(http.StatusNotModified)
+				return
+			}
+		}
+
+		renderPost(c, post, nil)
+	}
+	r.GET("/post/:id", showPost)
+	r.GET("/post/:id/:slug", showPost)
+
+	// Route to display the edit form for a post
+	r.GET("/post/:id/edit", requireAuth(), func(c *gin.Context) {
+		post, err := getPostByID(c.Request.Context(), db, postIDParam(c))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				renderNotFound(c, "That post doesn't exist or has been deleted.")
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		if !canModify(c, post.AuthorID, cfg.AdminUsers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own posts"})
+			return
+		}
+		renderTemplate(c, "edit_post.html", map[string]interface{}{
+			"Post": post,
+		})
+	})
+
+	// Route to save changes to a post
+	r.POST("/post/:id/edit", requireAuth(), func(c *gin.Context) {
+		id := postIDParam(c)
+		authorID, err := getPostAuthorID(c.Request.Context(), db, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		if !canModify(c, authorID, cfg.AdminUsers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own posts"})
+			return
+		}
+		title := strings.TrimSpace(c.PostForm("title"))
+		content := c.PostForm("content")
+		if errs := validatePost(title, c.PostForm("link"), content); errs != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errs[0].Message})
+			return
+		}
+		link, err := validateLink(c.PostForm("link"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		version, err := strconv.Atoi(c.PostForm("version"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post version"})
+			return
+		}
+		if err := updatePost(c.Request.Context(), db, id, version, title, content, link); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			case errEditConflict:
+				// Show the latest version so the editor can reapply their changes
+				post, err := getPostByID(c.Request.Context(), db, id)
+				if err != nil {
+					serverError(c, err)
+					return
+				}
+				c.Status(http.StatusConflict)
+				renderTemplate(c, "edit_post.html", map[string]interface{}{
+					"Post":  post,
+					"Error": "Someone else changed this post while you were editing it. Their version is shown below; please make your changes again.",
+				})
+			default:
+				serverError(c, err)
+			}
+			return
+		}
+		c.Redirect(http.StatusFound, "/post/"+strconv.Itoa(id))
+	})
+
+	// Route to delete a post and its comments
+	r.POST("/post/:id/delete", requireAuth(), func(c *gin.Context) {
+		id := postIDParam(c)
+		authorID, err := getPostAuthorID(c.Request.Context(), db, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		if !canModify(c, authorID, cfg.AdminUsers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own posts"})
+			return
+		}
+		if err := deletePost(c.Request.Context(), db, id); err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				serverError(c, err)
 			}
 			return
 		}
+		c.Redirect(http.StatusFound, nextPath(c, "/"))
+	})
 
-		// SQL query to select comments for a post ordered by creation time in descending order
-		rows, err := db.Query("SELECT id, content, created_at FROM comments WHERE post_id = $1 ORDER BY created_at DESC", id)
+	// Route to add a comment to a post
+	r.POST("/post/:id/comment", requireAuth(), func(c *gin.Context) {
+		id := c.Param("id")
+		postID, err := strconv.Atoi(id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+		// Deleted posts take no more comments, like they take no votes
+		post, err := getPostByID(c.Request.Context(), db, postID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			} else {
+				serverError(c, err)
+			}
 			return
 		}
-		defer rows.Close()
+		content := c.PostForm("content")
 
-		var comments []Comment
-		for rows.Next() {
-			var comment Comment
-			if err := rows.Scan(&comment.ID, &comment.Content, &comment.CreatedAt); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// Invalid or too hasty comments bring back the post with the input kept and the reason under it
+		rejectComment := func(status int, errs fieldErrors) {
+			c.Status(status)
+			renderPost(c, post, map[string]interface{}{
+				"FieldErrors": errs.Map(),
+				"CommentForm": map[string]string{
+					"Content":  content,
+					"Author":   c.PostForm("author"),
+					"ParentID": c.PostForm("parent_id"),
+				},
+			})
+		}
+		if errs := validateComment(content); errs != nil {
+			rejectComment(http.StatusBadRequest, errs)
+			return
+		}
+
+		// An optional parent_id makes the comment a reply, which must belong to the same post
+		// Replies past the maximum depth are attached higher up the thread.
+		var parentID *int
+		if raw := c.PostForm("parent_id"); raw != "" {
+			pid, err := strconv.Atoi(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parent comment ID"})
+				return
+			}
+			parentPostID, err := getCommentPostID(c.Request.Context(), db, pid)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Parent comment not found"})
+				} else {
+					serverError(c, err)
+				}
+				return
+			}
+			if parentPostID != postID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Parent comment belongs to a different post"})
+				return
+			}
+			if parentID, err = replyParent(c.Request.Context(), db, pid, cfg.MaxCommentDepth); err != nil {
+				serverError(c, err)
 				return
 			}
-			comment.PostID = post.ID
-			comments = append(comments, comment)
 		}
-		if err := rows.Err(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+
+		commenter := voterKey(c)
+		if wait := commentWait.wait(commenter); wait > 0 {
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			rejectComment(http.StatusTooManyRequests, fieldErrors{{"content", "You're commenting too fast, please wait " + plural(seconds, "second") + " and try again"}})
+			return
+		}
+
+		commentID, err := createComment(c.Request.Context(), db, postID, parentID, content, currentUserID(c), authorName(c, c.PostForm("author")))
+		if err != nil {
+			commentWait.release(commenter)
+			if err == sql.ErrNoRows {
+				// Deleted while the comment was being checked
+				c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		notifyPostAuthor(c, db, mailer, postID)
+		// Land on the new comment so a reply is seen in its thread
+		page, err := commentPage(c.Request.Context(), db, commentID, cfg.CommentsPerPage)
+		if err != nil {
+			serverError(c, err)
 			return
 		}
+		c.Redirect(http.StatusFound, Comment{ID: commentID, PostID: postID}.PageURL(page))
+	})
 
-		post.Comments = comments
+	// Route to delete a comment from a post
+	r.POST("/post/:id/comment/:commentID/delete", requireAuth(), func(c *gin.Context) {
+		id := c.Param("id")
+		postID, err := strconv.Atoi(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+		commentID, err := strconv.Atoi(c.Param("commentID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+			return
+		}
 
-		renderTemplate(c, "templates/post_detail.html", map[string]interface{}{
-			"Post": post,
-		})
+		// Make sure the comment belongs to the post in the URL to prevent cross-post deletion
+		commentPostID, authorID, err := getCommentOwner(c.Request.Context(), db, commentID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		// A comment under another post is as good as missing from this one
+		if commentPostID != postID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return
+		}
+		if !canModify(c, authorID, cfg.AdminUsers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own comments"})
+			return
+		}
+
+		if err := deleteComment(c.Request.Context(), db, commentID); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		c.Redirect(http.StatusFound, nextPath(c, "/post/"+id))
 	})
 
-	// Route to add a comment to a post
-	r.POST("/post/:id/comment", func(c *gin.Context) {
+	// Route to edit a comment shortly after it was posted
+	r.POST("/post/:id/comment/:commentID/edit", requireAuth(), func(c *gin.Context) {
 		id := c.Param("id")
+		postID, err := strconv.Atoi(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+		commentID, err := strconv.Atoi(c.Param("commentID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+			return
+		}
 		content := c.PostForm("content")
-		// SQL query to insert a new comment into the 'comments' table
-		if _, err := db.Exec("INSERT INTO comments (content, post_id, created_at) VALUES ($1, $2, CURRENT_TIMESTAMP)", content, id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errs := validateComment(content); errs != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errs[0].Message})
+			return
+		}
+
+		commentPostID, authorID, err := getCommentOwner(c.Request.Context(), db, commentID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+		// A comment under another post is as good as missing from this one
+		if commentPostID != postID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return
+		}
+		if !canModify(c, authorID, cfg.AdminUsers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own comments"})
+			return
+		}
+
+		if err := updateComment(c.Request.Context(), db, commentID, content, cfg.CommentEditWindow); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Comments can only be edited shortly after they are posted"})
+			} else {
+				serverError(c, err)
+			}
 			return
 		}
 		c.Redirect(http.StatusFound, "/post/"+id)
 	})
 
-	// Start the server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Account routes
+	registerAuthRoutes(r, db)
+
+	// Feature routes, each registered from its own file
+	registerVoteRoutes(r, db, cfg.PointsFloor)
+	registerTagRoutes(r, db)
+	registerDomainRoutes(r, db)
+	registerFlagRoutes(r, db)
+	registerCommentRoutes(r, db)
+	registerProfileRoutes(r, db)
+	registerAdminRoutes(r, db, cfg.AdminUsers, cfg.MaxPinnedPosts)
+	registerExportRoutes(r, db, cfg.AdminUsers)
+	registerRandomRoutes(r, db)
+	registerImageRoutes(r, db, images)
+	registerFavoriteRoutes(r, db)
+
+	// RSS feed of recent posts
+	registerFeedRoutes(r, db)
+
+	// JSON API routes
+	registerAPIRoutes(r, db, corsHeaders(cfg.CORSOrigins, cfg.CORSMethods, cfg.CORSHeaders), cfg.AdminUsers, cfg.MaxCommentDepth, cfg.PointsFloor)
+
+	// Unknown routes get a JSON error under /api and the 404 page everywhere else
+	r.NoRoute(func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			abortJSON(c, http.StatusNotFound, errCodeNotFound, "Not found")
+			return
+		}
+		renderNotFound(c, "The page you're looking for doesn't exist.")
+	})
+
+	// Start the server in the background so we can listen for shutdown signals
+	server := &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      r,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	go func() {
+		slog.Info("Server started", "port", cfg.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Server failed", err)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM, then let in-flight requests drain before exiting
+	<-ctx.Done()
+	slog.Info("Shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Server forced to shut down", "error", err)
+	}
+
+	// Close the database only after the server has drained
+	if err := db.Close(); err != nil {
+		slog.Error("Error closing database", "error", err)
 	}
-	log.Printf("Server started on port %s", port)
-	r.Run(":" + port)
+	slog.Info("Server exited")
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdownRenderer converts CommonMark to HTML
+// Raw HTML in the input is omitted by goldmark's default (safe) renderer,
+// and bare URLs are turned into links.
+var markdownRenderer = goldmark.New(
+	goldmark.WithExtensions(extension.Linkify),
+)
+
+// renderMarkdown renders stored Markdown content as HTML for templates
+// The output still goes through sanitizeContent so only allowlisted tags and
+// safe links reach the page, whatever the renderer produces.
+func renderMarkdown(content string) template.HTML {
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(content), &buf); err != nil {
+		return template.HTML("<p>" + template.HTMLEscapeString(content) + "</p>")
+	}
+	return template.HTML(sanitizeContent(buf.String()))
+}
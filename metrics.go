@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// dbStatsInterval is how often connection pool statistics are sampled
+const dbStatsInterval = 15 * time.Second
+
+// metrics holds the Prometheus collectors exposed on /metrics
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	dbConnections   *prometheus.GaugeVec
+}
+
+// newMetrics registers the HTTP and database collectors along with the Go runtime and process metrics
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests processed, by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency, by method, route and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		dbConnections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "db_connections",
+			Help: "Database connections in the pool, by state (open, in_use, idle).",
+		}, []string{"state"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.dbConnections,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// middleware records the count and latency of every request
+// Requests are labelled by route pattern rather than raw path, so /post/1 and
+// /post/2 share a series; unmatched paths are grouped under one label.
+func (m *metrics) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		m.requests.WithLabelValues(c.Request.Method, route, status).Inc()
+		m.requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// handler serves the collected metrics in the Prometheus text format
+func (m *metrics) handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// runDBStats samples the connection pool statistics until ctx is cancelled
+func (m *metrics) runDBStats(ctx context.Context, db *sql.DB) {
+	ticker := time.NewTicker(dbStatsInterval)
+	defer ticker.Stop()
+	for {
+		m.recordDBStats(db)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordDBStats copies the current connection pool statistics into the gauges
+func (m *metrics) recordDBStats(db *sql.DB) {
+	stats := db.Stats()
+	m.dbConnections.WithLabelValues("open").Set(float64(stats.OpenConnections))
+	m.dbConnections.WithLabelValues("in_use").Set(float64(stats.InUse))
+	m.dbConnections.WithLabelValues("idle").Set(float64(stats.Idle))
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Migration is a versioned schema change applied once on startup
+type Migration struct {
+	Version int
+	SQL     string // PostgreSQL statements; empty for a migration that only backfills
+	SQLite  string // SQLite statements; empty when SQL works on both drivers
+
+	// Backfill optionally fills in data that SQL alone cannot compute
+	// It runs in the migration's transaction, after the statements.
+	Backfill func(ctx context.Context, tx *sql.Tx) error
+}
+
+// migrations lists every schema change in the order it must be applied
+// Append new migrations to the end; never edit or reorder one that has shipped.
+// The early migrations use IF NOT EXISTS so databases created before the
+// migration runner existed are brought under version control without errors.
+var migrations = []Migration{
+	{
+		Version: 1,
+		SQL: `
+            CREATE TABLE IF NOT EXISTS posts (
+                id SERIAL PRIMARY KEY, -- Auto - incrementing primary key
+                title VARCHAR(255) NOT NULL, -- Post title
+                link VARCHAR(255) NOT NULL DEFAULT '', -- Post link
+                content TEXT NOT NULL, -- Post content
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- Creation time
+            );
+            CREATE TABLE IF NOT EXISTS comments (
+                id SERIAL PRIMARY KEY, -- Auto - incrementing primary key
+                content TEXT NOT NULL, -- Comment content
+                post_id INTEGER NOT NULL, -- ID of the related post
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Creation time
+                FOREIGN KEY (post_id) REFERENCES posts(id) -- Foreign key referencing 'posts' table
+            );
+        `,
+		SQLite: `
+            CREATE TABLE IF NOT EXISTS posts (
+                id INTEGER PRIMARY KEY AUTOINCREMENT, -- Auto - incrementing primary key
+                title VARCHAR(255) NOT NULL, -- Post title
+                link VARCHAR(255) NOT NULL DEFAULT '', -- Post link
+                content TEXT NOT NULL, -- Post content
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- Creation time
+            );
+            CREATE TABLE IF NOT EXISTS comments (
+                id INTEGER PRIMARY KEY AUTOINCREMENT, -- Auto - incrementing primary key
+                content TEXT NOT NULL, -- Comment content
+                post_id INTEGER NOT NULL, -- ID of the related post
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Creation time
+                FOREIGN KEY (post_id) REFERENCES posts(id) -- Foreign key referencing 'posts' table
+            );
+        `,
+	},
+	{
+		Version: 2,
+		SQL:     `ALTER TABLE posts ADD COLUMN IF NOT EXISTS points INTEGER NOT NULL DEFAULT 0; -- Upvote count`,
+		SQLite:  `ALTER TABLE posts ADD COLUMN points INTEGER NOT NULL DEFAULT 0; -- Upvote count`,
+	},
+	{
+		Version: 3,
+		SQL:     `ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_id INTEGER NULL REFERENCES comments(id); -- ID of the parent comment for replies`,
+		SQLite:  `ALTER TABLE comments ADD COLUMN parent_id INTEGER NULL REFERENCES comments(id); -- ID of the parent comment for replies`,
+	},
+	{
+		Version: 4,
+		SQL: `
+            CREATE TABLE users (
+                id SERIAL PRIMARY KEY, -- Auto - incrementing primary key
+                username VARCHAR(32) NOT NULL UNIQUE, -- Login name
+                password_hash VARCHAR(255) NOT NULL, -- bcrypt hash of the password
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- Creation time
+            );
+            CREATE TABLE sessions (
+                token VARCHAR(64) PRIMARY KEY, -- Random session token stored in the cookie
+                user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- Logged-in user
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Creation time
+                expires_at TIMESTAMP NOT NULL -- Time after which the session is invalid
+            );
+            ALTER TABLE posts ADD COLUMN author_id INTEGER NULL REFERENCES users(id); -- Submitting user
+            ALTER TABLE comments ADD COLUMN author_id INTEGER NULL REFERENCES users(id); -- Commenting user
+        `,
+		SQLite: `
+            CREATE TABLE users (
+                id INTEGER PRIMARY KEY AUTOINCREMENT, -- Auto - incrementing primary key
+                username VARCHAR(32) NOT NULL UNIQUE, -- Login name
+                password_hash VARCHAR(255) NOT NULL, -- bcrypt hash of the password
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- Creation time
+            );
+            CREATE TABLE sessions (
+                token VARCHAR(64) PRIMARY KEY, -- Random session token stored in the cookie
+                user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- Logged-in user
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Creation time
+                expires_at TIMESTAMP NOT NULL -- Time after which the session is invalid
+            );
+            ALTER TABLE posts ADD COLUMN author_id INTEGER NULL REFERENCES users(id); -- Submitting user
+            ALTER TABLE comments ADD COLUMN author_id INTEGER NULL REFERENCES users(id); -- Commenting user
+        `,
+	},
+	{
+		Version: 5,
+		SQL: `
+            CREATE TABLE post_tags (
+                post_id INTEGER NOT NULL REFERENCES posts(id), -- Tagged post
+                tag VARCHAR(32) NOT NULL, -- Normalized lowercase tag name
+                PRIMARY KEY (post_id, tag)
+            );
+            CREATE INDEX post_tags_tag_idx ON post_tags (tag); -- Speeds up per-tag listings
+        `,
+	},
+	{
+		Version: 6,
+		SQL:     `ALTER TABLE posts ADD COLUMN slug VARCHAR(255) NOT NULL DEFAULT ''; -- URL slug derived from the title`,
+	},
+	{
+		Version: 7,
+		SQL: `
+            CREATE TABLE votes (
+                post_id INTEGER NOT NULL REFERENCES posts(id), -- Voted post
+                voter VARCHAR(64) NOT NULL, -- "user:<id>" for logged-in users, "ip:<address>" otherwise
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Creation time
+                PRIMARY KEY (post_id, voter)
+            );
+        `,
+	},
+	{
+		Version: 8,
+		SQL: `
+            ALTER TABLE votes ADD COLUMN value INTEGER NOT NULL DEFAULT 1; -- +1 for an upvote, -1 for a downvote
+            -- Keep points from before every vote was recorded as a single catch-all vote,
+            -- so recomputing points as the sum of votes doesn't reset older posts
+            INSERT INTO votes (post_id, voter, value)
+            SELECT p.id, 'legacy', p.points - (SELECT COUNT(*) FROM votes v WHERE v.post_id = p.id)
+            FROM posts p
+            WHERE p.points <> (SELECT COUNT(*) FROM votes v WHERE v.post_id = p.id);
+        `,
+	},
+	{
+		Version: 9,
+		SQL: `
+            ALTER TABLE posts ADD COLUMN type VARCHAR(8) NOT NULL DEFAULT 'link'; -- 'link' or 'text'
+            UPDATE posts SET type = 'text' WHERE link = '';
+        `,
+	},
+	{
+		Version: 10,
+		SQL:     `ALTER TABLE comments ADD COLUMN edited_at TIMESTAMP NULL; -- Time of the last edit, if any`,
+	},
+	{
+		Version: 11,
+		SQL:     `ALTER TABLE posts ADD COLUMN version INTEGER NOT NULL DEFAULT 1; -- Optimistic concurrency version, bumped on every edit`,
+	},
+	{
+		Version: 12,
+		SQL: `
+            CREATE TABLE favorites (
+                user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- User who saved the post
+                post_id INTEGER NOT NULL REFERENCES posts(id), -- Saved post
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Time the post was saved
+                PRIMARY KEY (user_id, post_id)
+            );
+        `,
+	},
+	{
+		Version: 13,
+		SQL: `
+            ALTER TABLE posts ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT ''; -- Normalized link host, empty for text posts
+            CREATE INDEX posts_host_idx ON posts (host);
+        `,
+		Backfill: backfillPostHosts,
+	},
+	{
+		Version: 14,
+		SQL: `
+            CREATE TABLE flags (
+                target_type VARCHAR(16) NOT NULL, -- 'post' or 'comment'
+                target_id INTEGER NOT NULL, -- ID of the flagged post or comment
+                reporter INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- User who flagged it
+                reason TEXT NOT NULL DEFAULT '', -- Optional explanation from the reporter
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Time of the flag
+                PRIMARY KEY (target_type, target_id, reporter)
+            );
+            ALTER TABLE posts ADD COLUMN flag_count INTEGER NOT NULL DEFAULT 0; -- Number of distinct flags on the post
+        `,
+	},
+	{
+		Version: 15,
+		SQL:     `ALTER TABLE posts ADD COLUMN deleted_at TIMESTAMP NULL; -- Time the post was soft-deleted, if it was`,
+	},
+	{
+		Version: 16,
+		SQL:     `ALTER TABLE comments ADD COLUMN status VARCHAR(8) NOT NULL DEFAULT 'live'; -- 'live', or 'dead' once hidden by a moderator`,
+	},
+	{
+		Version: 17,
+		SQL: `
+            CREATE INDEX IF NOT EXISTS posts_created_at_idx ON posts (created_at DESC); -- Newest listing and the feed
+            CREATE INDEX IF NOT EXISTS posts_points_idx ON posts (points DESC, created_at DESC); -- Top listing
+            CREATE INDEX IF NOT EXISTS comments_post_id_idx ON comments (post_id, created_at); -- Comment threads and counts
+        `,
+	},
+	{
+		Version: 18,
+		SQL: `
+            ALTER TABLE users ADD COLUMN karma INTEGER NOT NULL DEFAULT 0; -- Points across the user's live posts, kept up to date on every vote
+            UPDATE users SET karma = (SELECT COALESCE(SUM(points), 0) FROM posts WHERE author_id = users.id AND deleted_at IS NULL);
+        `,
+	},
+	{
+		Version: 19,
+		SQL:     `ALTER TABLE users ADD COLUMN email VARCHAR(255) NOT NULL DEFAULT ''; -- Optional address for reply notifications`,
+	},
+	{
+		Version: 20,
+		SQL: `
+            ALTER TABLE posts ADD COLUMN hot_score DOUBLE PRECISION NOT NULL DEFAULT 0; -- Stored hot ranking, refreshed by the hot score worker
+            CREATE INDEX IF NOT EXISTS posts_hot_score_idx ON posts (hot_score DESC, created_at DESC); -- Hot listing
+        `,
+	},
+	{
+		Version: 21,
+		SQL: `
+            ALTER TABLE posts ADD COLUMN updated_at TIMESTAMP NULL; -- Time of the last edit, set to created_at on insert
+            UPDATE posts SET updated_at = created_at;
+        `,
+	},
+	{
+		Version: 22,
+		SQL: `
+            ALTER TABLE posts ADD COLUMN link_key VARCHAR(2048) NOT NULL DEFAULT ''; -- Normalized link used to detect duplicate submissions, empty for text posts
+            CREATE INDEX posts_link_key_idx ON posts (link_key);
+        `,
+		Backfill: backfillPostLinkKeys,
+	},
+	{
+		Version: 23,
+		SQL: `
+            ALTER TABLE posts ADD COLUMN author VARCHAR(64) NOT NULL DEFAULT 'anonymous'; -- Display name given at submission
+            ALTER TABLE comments ADD COLUMN author VARCHAR(64) NOT NULL DEFAULT 'anonymous'; -- Display name given at submission
+            UPDATE posts SET author = (SELECT username FROM users WHERE users.id = posts.author_id) WHERE author_id IS NOT NULL;
+            UPDATE comments SET author = (SELECT username FROM users WHERE users.id = comments.author_id) WHERE author_id IS NOT NULL;
+        `,
+	},
+	{
+		Version: 24,
+		SQL:     `ALTER TABLE posts ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT false; -- Kept at the top of the front page by an admin`,
+	},
+	{
+		Version: 25,
+		SQL: `
+            ALTER TABLE posts ADD COLUMN image_path VARCHAR(255) NOT NULL DEFAULT ''; -- File name of the post image, empty without one
+            CREATE TABLE post_images (
+                post_id INTEGER PRIMARY KEY REFERENCES posts(id), -- Post the image belongs to
+                data BYTEA NOT NULL -- Image bytes, when images are not stored in IMAGE_DIR
+            );
+        `,
+		SQLite: `
+            ALTER TABLE posts ADD COLUMN image_path VARCHAR(255) NOT NULL DEFAULT ''; -- File name of the post image, empty without one
+            CREATE TABLE post_images (
+                post_id INTEGER PRIMARY KEY REFERENCES posts(id), -- Post the image belongs to
+                data BLOB NOT NULL -- Image bytes, when images are not stored in IMAGE_DIR
+            );
+        `,
+	},
+	{
+		Version:  26,
+		Backfill: backfillReservedSlugs,
+	},
+	{
+		// "image" joined reservedSlugs after version 26 shipped
+		Version:  27,
+		Backfill: backfillReservedSlugs,
+	},
+	{
+		Version: 28,
+		SQL: `
+            ALTER TABLE comments ADD COLUMN updated_at TIMESTAMP NULL; -- Time of the last change, including moderation; set to created_at on insert
+            UPDATE comments SET updated_at = COALESCE(edited_at, created_at);
+            CREATE INDEX comments_updated_at_idx ON comments (post_id, updated_at); -- Last change of a thread for conditional requests
+        `,
+	},
+}
+
+// migrate applies all pending migrations in version order
+// Applied versions are recorded in the 'migrations' table, and each migration
+// runs in its own transaction so a failure leaves no partial schema change.
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS migrations (
+            version INTEGER PRIMARY KEY, -- Applied migration version
+            applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- Time the migration was applied
+        );
+    `); err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.QueryContext(ctx, "SELECT version FROM migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		slog.Info("Applied migration", "version", m.Version)
+	}
+	return nil
+}
+
+// applyMigration runs a single migration and records its version in one transaction
+func applyMigration(ctx context.Context, db *sql.DB, m Migration) error {
+	return withTx(ctx, db, func(tx *sql.Tx) error {
+		if query := dialectQuery(db, m.SQL, m.SQLite); query != "" {
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+		if m.Backfill != nil {
+			if err := m.Backfill(ctx, tx); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO migrations (version) VALUES ($1)", m.Version)
+		return err
+	})
+}
+
+// backfillReservedSlugs regenerates the slugs of posts that collide with a route in reservedSlugs
+func backfillReservedSlugs(ctx context.Context, tx *sql.Tx) error {
+	reserved := make([]interface{}, 0, len(reservedSlugs))
+	placeholders := make([]string, 0, len(reservedSlugs))
+	for slug := range reservedSlugs {
+		reserved = append(reserved, slug)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(reserved)))
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT id, title FROM posts WHERE slug IN ("+strings.Join(placeholders, ", ")+")", reserved...)
+	if err != nil {
+		return err
+	}
+	slugs := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			rows.Close()
+			return err
+		}
+		slugs[id] = slugify(title)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, slug := range slugs {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET slug = $1 WHERE id = $2", slug, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillPostHosts stores the normalized host of every existing link post
+func backfillPostHosts(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, link FROM posts WHERE link <> ''")
+	if err != nil {
+		return err
+	}
+	hosts := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var link string
+		if err := rows.Scan(&id, &link); err != nil {
+			rows.Close()
+			return err
+		}
+		hosts[id] = linkHost(link)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Update after the rows are closed since the transaction holds a single connection
+	for id, host := range hosts {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET host = $1 WHERE id = $2", host, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillPostLinkKeys fills in the normalized link of posts created before link_key was stored
+func backfillPostLinkKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, link FROM posts WHERE link <> ''")
+	if err != nil {
+		return err
+	}
+	keys := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var link string
+		if err := rows.Scan(&id, &link); err != nil {
+			rows.Close()
+			return err
+		}
+		keys[id] = normalizeURL(link)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, key := range keys {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET link_key = $1 WHERE id = $2", key, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
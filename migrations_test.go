@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMigrateIndexes(t *testing.T) {
+	db := newTestDB(t)
+	// Running again must find every migration applied and change nothing
+	if err := migrate(context.Background(), db); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		index string
+	}{
+		{"SELECT id FROM posts ORDER BY created_at DESC LIMIT 30", "posts_created_at_idx"},
+		{"SELECT id FROM posts ORDER BY points DESC, created_at DESC LIMIT 30", "posts_points_idx"},
+		{"SELECT id FROM posts ORDER BY hot_score DESC, created_at DESC LIMIT 30", "posts_hot_score_idx"},
+		{"SELECT id FROM comments WHERE post_id = 1 ORDER BY created_at", "comments_post_id_idx"},
+		{"SELECT updated_at FROM comments WHERE post_id = 1 ORDER BY updated_at DESC LIMIT 1", "comments_updated_at_idx"},
+		{"SELECT id FROM posts WHERE link_key = 'example.com/a'", "posts_link_key_idx"},
+		{"SELECT post_id FROM post_tags WHERE tag = 'go'", "post_tags_tag_idx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.index, func(t *testing.T) {
+			rows, err := db.Query("EXPLAIN QUERY PLAN " + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var plan []string
+			for rows.Next() {
+				var id, parent, unused int
+				var detail string
+				if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+					t.Fatal(err)
+				}
+				plan = append(plan, detail)
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(strings.Join(plan, "\n"), tt.index) {
+				t.Errorf("%s\nplan %q does not use %s", tt.query, plan, tt.index)
+			}
+		})
+	}
+}
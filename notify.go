@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notifyQueueSize is how many emails may wait to be sent before new ones are dropped
+const notifyQueueSize = 100
+
+// email is a plain-text message waiting to be sent
+type email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// notifier sends emails over SMTP from a background goroutine
+// A nil *notifier is valid and drops every message, which is how email is disabled.
+type notifier struct {
+	addr    string
+	from    string
+	auth    smtp.Auth
+	baseURL string // Configured BASE_URL for links in messages, empty to leave links out
+	queue   chan email
+}
+
+// newNotifier returns a notifier for the configured mail server, or nil if SMTP_HOST is unset
+func newNotifier(cfg *Config) *notifier {
+	if cfg.SMTPHost == "" {
+		return nil
+	}
+	n := &notifier{
+		addr:    net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		from:    cfg.SMTPFrom,
+		baseURL: cfg.BaseURL,
+		queue:   make(chan email, notifyQueueSize),
+	}
+	// Links are never derived from the request, whose Host header any commenter could set
+	if n.baseURL == "" {
+		slog.Warn("BASE_URL is not set, emails will not link to the site")
+	}
+	if cfg.SMTPUsername != "" {
+		n.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return n
+}
+
+// send queues a message without waiting for it to be delivered
+// When the queue is full the message is dropped rather than slowing down the request.
+func (n *notifier) send(msg email) {
+	if n == nil {
+		return
+	}
+	select {
+	case n.queue <- msg:
+	default:
+		slog.Warn("Email queue full, dropping message", "to", msg.To, "subject", msg.Subject)
+	}
+}
+
+// run delivers queued messages until ctx is cancelled
+// Failed deliveries are logged and not retried.
+func (n *notifier) run(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-n.queue:
+			if err := n.deliver(msg); err != nil {
+				slog.Error("Cannot send email", "to", msg.To, "subject", msg.Subject, "error", err)
+			}
+		}
+	}
+}
+
+// deliver sends a single message to the mail server
+func (n *notifier) deliver(msg email) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return smtp.SendMail(n.addr, n.auth, n.from, []string{msg.To}, []byte(b.String()))
+}
+
+// notifyPostAuthor emails the author of a post about a new comment on it
+// Nothing is sent for anonymous posts, authors without an email address, or
+// comments by the author. Lookup failures are logged since the comment itself
+// has already been saved.
+func notifyPostAuthor(c *gin.Context, db *sql.DB, n *notifier, postID int) {
+	if n == nil {
+		return
+	}
+	post, err := getPostByID(c.Request.Context(), db, postID)
+	if err != nil {
+		slog.Warn("Cannot load post for reply notification", "post_id", postID, "error", err)
+		return
+	}
+	if post.AuthorID == nil {
+		return
+	}
+	if id := currentUserID(c); id != nil && *id == *post.AuthorID {
+		return
+	}
+	var address string
+	if err := db.QueryRowContext(c.Request.Context(), "SELECT email FROM users WHERE id = $1", *post.AuthorID).Scan(&address); err != nil {
+		slog.Warn("Cannot load author for reply notification", "post_id", postID, "error", err)
+		return
+	}
+	if address == "" {
+		return
+	}
+
+	commenter := "Someone"
+	if user := currentUser(c); user != nil {
+		commenter = user.Username
+	}
+	// Strip line breaks so a title cannot inject extra headers
+	title := strings.NewReplacer("\r", " ", "\n", " ").Replace(post.Title)
+	body := fmt.Sprintf("%s commented on your post \"%s\".\n", commenter, title)
+	if n.baseURL != "" {
+		body += "\n" + n.baseURL + post.URL() + "\n"
+	}
+	n.send(email{
+		To:      address,
+		Subject: "New comment on " + title,
+		Body:    body,
+	})
+}
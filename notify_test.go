@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNotifyPostAuthorLink(t *testing.T) {
+	db := newTestDB(t)
+	author, err := createUser(context.Background(), db, "alice", "password123", "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := testPost(t, db, "Hello", "", &author.ID)
+
+	tests := []struct {
+		name    string
+		baseURL string
+		want    string // Link expected in the body, empty for none
+	}{
+		{"configured base URL", "https://news.example.com", "https://news.example.com/post/1/hello"},
+		{"no base URL", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &notifier{baseURL: tt.baseURL, queue: make(chan email, 1)}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			// A commenter picking the Host header must not pick the host of the link
+			c.Request = httptest.NewRequest(http.MethodPost, "/post/1/comment", nil)
+			c.Request.Host = "evil.example"
+			notifyPostAuthor(c, db, n, post)
+
+			msg := <-n.queue
+			if msg.To != "alice@example.com" {
+				t.Errorf("sent to %q, want %q", msg.To, "alice@example.com")
+			}
+			if strings.Contains(msg.Body, "evil.example") {
+				t.Errorf("body links to the request host: %q", msg.Body)
+			}
+			if tt.want != "" && !strings.Contains(msg.Body, tt.want) {
+				t.Errorf("body %q does not link to %q", msg.Body, tt.want)
+			}
+			if tt.want == "" && strings.Contains(msg.Body, "http") {
+				t.Errorf("body %q has a link without BASE_URL", msg.Body)
+			}
+		})
+	}
+}
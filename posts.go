@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// postColumns lists the post columns every post query selects, in the order scanPost reads them
+// Queries alias the posts table as p and append a comment count column.
+const postColumns = "p.id, p.title, p.slug, p.type, p.link, p.host, p.content, p.points, p.author_id, p.author, p.created_at, p.updated_at, p.version, p.pinned, p.image_path"
+
+// postListOptions selects and orders a page of posts for listPosts
+// Empty filters match every live post.
+type postListOptions struct {
+	Sort     string // Listing order, see parseSort
+	Tag      string // Only posts carrying this tag
+	Host     string // Only posts linking to this normalized host
+	Deleted  bool   // List soft-deleted posts instead of live ones
+	AuthorID int    // Only posts submitted by this user
+
+	// MaxFlags hides posts with more than this many flags; 0 shows them all
+	MaxFlags int
+	// MaxPerHost pushes a site's posts beyond this many below those of other sites; 0 disables it
+	MaxPerHost int
+	// PinnedFirst lists pinned posts before all others
+	PinnedFirst bool
+
+	Limit  int
+	Offset int
+}
+
+// where returns the WHERE clause and arguments for the filters in opts
+func (opts postListOptions) where() (string, []interface{}) {
+	conds := []string{"p.deleted_at IS NULL"}
+	if opts.Deleted {
+		conds[0] = "p.deleted_at IS NOT NULL"
+	}
+	var args []interface{}
+	if opts.Tag != "" {
+		args = append(args, opts.Tag)
+		conds = append(conds, fmt.Sprintf("p.id IN (SELECT post_id FROM post_tags WHERE tag = $%d)", len(args)))
+	}
+	if opts.Host != "" {
+		args = append(args, opts.Host)
+		conds = append(conds, fmt.Sprintf("p.host = $%d", len(args)))
+	}
+	if opts.AuthorID != 0 {
+		args = append(args, opts.AuthorID)
+		conds = append(conds, fmt.Sprintf("p.author_id = $%d", len(args)))
+	}
+	if opts.MaxFlags > 0 {
+		args = append(args, opts.MaxFlags)
+		conds = append(conds, fmt.Sprintf("p.flag_count <= $%d", len(args)))
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// orderBy returns the ORDER BY expression for opts, putting pinned posts first if requested
+func (opts postListOptions) orderBy() string {
+	if opts.PinnedFirst {
+		return "p.pinned DESC, " + orderByClause(opts.Sort)
+	}
+	return orderByClause(opts.Sort)
+}
+
+// countPosts returns the number of posts matching the filters in opts
+func countPosts(ctx context.Context, db *sql.DB, opts postListOptions) (int, error) {
+	where, args := opts.where()
+	var total int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts p "+where, args...).Scan(&total)
+	return total, err
+}
+
+// listPosts returns a page of posts matching opts with their comment counts and tags
+func listPosts(ctx context.Context, db *sql.DB, opts postListOptions) ([]Post, error) {
+	if opts.MaxPerHost > 0 {
+		return listPostsPerHost(ctx, db, opts)
+	}
+	where, args := opts.where()
+	args = append(args, opts.Limit, opts.Offset)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+        SELECT %s, COUNT(c.id)
+        FROM posts p
+        LEFT JOIN comments c ON c.post_id = p.id`+countedComments()+`
+        %s
+        GROUP BY p.id
+        ORDER BY %s
+        LIMIT $%d OFFSET $%d
+    `, postColumns, where, opts.orderBy(), len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return nil, err
+	}
+	return posts, attachTags(ctx, db, posts)
+}
+
+// listPostsPerHost lists posts like listPosts while spreading out those from the same site
+// Each post is ranked among the posts of its host in the requested order. The
+// first MaxPerHost of every host come first, then the next MaxPerHost and so
+// on, each group keeping the requested order, so paging stays consistent.
+// Text posts have no host and are never held back.
+func listPostsPerHost(ctx context.Context, db *sql.DB, opts postListOptions) ([]Post, error) {
+	where, args := opts.where()
+	args = append(args, opts.MaxPerHost, opts.Limit, opts.Offset)
+	order := orderByClause(opts.Sort)
+	pinned := ""
+	if opts.PinnedFirst {
+		pinned = "p.pinned DESC, "
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+        WITH ranked AS (
+            SELECT p.id, ROW_NUMBER() OVER (
+                PARTITION BY CASE WHEN p.host = '' THEN CAST(p.id AS VARCHAR(20)) ELSE p.host END
+                ORDER BY %s
+            ) AS host_rank
+            FROM posts p
+            %s
+        )
+        SELECT %s, COUNT(c.id)
+        FROM posts p
+        JOIN ranked r ON r.id = p.id
+        LEFT JOIN comments c ON c.post_id = p.id`+countedComments()+`
+        GROUP BY p.id, r.host_rank
+        ORDER BY %s(r.host_rank - 1) / $%d, %s
+        LIMIT $%d OFFSET $%d
+    `, order, where, postColumns, pinned, len(args)-2, order, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return nil, err
+	}
+	return posts, attachTags(ctx, db, posts)
+}
+
+// countSearchResults returns the number of posts matching a full-text search query
+func countSearchResults(ctx context.Context, db *sql.DB, query string) (int, error) {
+	var total int
+	err := db.QueryRowContext(ctx, dialectQuery(db, `
+        SELECT COUNT(*) FROM posts
+        WHERE deleted_at IS NULL AND to_tsvector('english', title || ' ' || content) @@ plainto_tsquery('english', $1)
+    `, `
+        SELECT COUNT(*) FROM posts
+        WHERE deleted_at IS NULL AND (title LIKE '%' || $1 || '%' OR content LIKE '%' || $1 || '%')
+    `), query).Scan(&total)
+	return total, err
+}
+
+// searchPosts returns a page of posts matching a full-text search query
+// over title and content, ordered by relevance, then by creation time in descending order
+// SQLite has no built-in full-text ranking, so it falls back to a substring match ordered by creation time.
+func searchPosts(ctx context.Context, db *sql.DB, query string, limit, offset int) ([]Post, error) {
+	rows, err := db.QueryContext(ctx, dialectQuery(db, `
+        SELECT `+postColumns+`, COUNT(c.id)
+        FROM posts p
+        LEFT JOIN comments c ON c.post_id = p.id`+countedComments()+`
+        WHERE p.deleted_at IS NULL AND to_tsvector('english', p.title || ' ' || p.content) @@ plainto_tsquery('english', $1)
+        GROUP BY p.id
+        ORDER BY ts_rank(to_tsvector('english', p.title || ' ' || p.content), plainto_tsquery('english', $1)) DESC, p.created_at DESC
+        LIMIT $2 OFFSET $3
+    `, `
+        SELECT `+postColumns+`, COUNT(c.id)
+        FROM posts p
+        LEFT JOIN comments c ON c.post_id = p.id`+countedComments()+`
+        WHERE p.deleted_at IS NULL AND (p.title LIKE '%' || $1 || '%' OR p.content LIKE '%' || $1 || '%')
+        GROUP BY p.id
+        ORDER BY p.created_at DESC
+        LIMIT $2 OFFSET $3
+    `), query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return nil, err
+	}
+	return posts, attachTags(ctx, db, posts)
+}
+
+// rowScanner is the Scan method shared by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPost reads postColumns followed by a comment count into a post
+func scanPost(row rowScanner) (Post, error) {
+	var post Post
+	var authorID sql.NullInt64
+	if err := row.Scan(
+		&post.ID,
+		&post.Title,
+		&post.Slug,
+		&post.Type,
+		&post.Link,
+		&post.Host,
+		&post.Content,
+		&post.Points,
+		&authorID,
+		&post.Author,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.Version,
+		&post.Pinned,
+		&post.ImagePath,
+		&post.CommentCount,
+	); err != nil {
+		return post, err
+	}
+	post.AuthorID = nullableInt(authorID)
+	post.Slug = postSlug(post.Slug, post.Title)
+	return post, nil
+}
+
+// scanPosts reads post listing rows with their comment counts and closes rows
+func scanPosts(rows *sql.Rows) ([]Post, error) {
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// getPostByID returns a single post with its comment count and tags
+// It returns sql.ErrNoRows if the post does not exist.
+func getPostByID(ctx context.Context, db *sql.DB, id int) (*Post, error) {
+	post, err := scanPost(db.QueryRowContext(ctx, `
+        SELECT `+postColumns+`,
+            (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id`+countedComments()+`) -- Comment count
+        FROM posts p
+        WHERE p.id = $1 AND p.deleted_at IS NULL
+    `, id))
+	if err != nil {
+		return nil, err
+	}
+	tags, err := loadTags(ctx, db, post.ID)
+	if err != nil {
+		return nil, err
+	}
+	post.Tags = tags[post.ID]
+	return &post, nil
+}
+
+// listComments returns all comments for a post ordered by creation time, oldest or newest first
+func listComments(ctx context.Context, db *sql.DB, postID int, sort string) ([]Comment, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+commentColumns+" FROM comments WHERE post_id = $1 ORDER BY "+commentOrder(sort), postID)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows, postID)
+}
+
+// listCommentsRange returns up to limit comments for a post, skipping the first offset, as a flat list
+func listCommentsRange(ctx context.Context, db *sql.DB, postID int, sort string, limit, offset int) ([]Comment, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+commentColumns+" FROM comments WHERE post_id = $1 ORDER BY "+commentOrder(sort)+" LIMIT $2 OFFSET $3", postID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows, postID)
+}
+
+// countRootComments returns the number of top-level comments on a post
+func countRootComments(ctx context.Context, db *sql.DB, postID int) (int, error) {
+	var total int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM comments WHERE post_id = $1 AND parent_id IS NULL", postID).Scan(&total)
+	return total, err
+}
+
+// listCommentPage returns a page of top-level comments on a post together with all of their replies
+// Pages are counted in top-level comments so a thread is never split across pages.
+func listCommentPage(ctx context.Context, db *sql.DB, postID int, sort string, limit, offset int) ([]Comment, error) {
+	order := commentOrder(sort)
+	rows, err := db.QueryContext(ctx, `
+        WITH RECURSIVE roots AS (
+            SELECT id FROM comments
+            WHERE post_id = $1 AND parent_id IS NULL
+            ORDER BY `+order+`
+            LIMIT $2 OFFSET $3
+        ), thread AS (
+            SELECT id FROM roots
+            UNION ALL
+            SELECT c.id FROM comments c JOIN thread t ON c.parent_id = t.id
+        )
+        SELECT `+commentColumns+` FROM comments
+        WHERE id IN (SELECT id FROM thread)
+        ORDER BY `+order+`
+    `, postID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows, postID)
+}
+
+// commentOrder returns the ORDER BY expression for a comment order
+func commentOrder(sort string) string {
+	if sort == commentSortNew {
+		return "created_at DESC, id DESC"
+	}
+	return "created_at ASC, id ASC"
+}
+
+// commentColumns lists the comment columns every comment listing selects, in the order scanComments reads them
+const commentColumns = "id, content, parent_id, author_id, author, created_at, edited_at, status"
+
+// scanComments reads comment rows belonging to postID and closes rows
+// Dead comments keep their place in the thread but lose their content.
+func scanComments(rows *sql.Rows, postID int) ([]Comment, error) {
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var comment Comment
+		var parentID, authorID sql.NullInt64
+		var editedAt sql.NullTime
+		if err := rows.Scan(&comment.ID, &comment.Content, &parentID, &authorID, &comment.Author, &comment.CreatedAt, &editedAt, &comment.Status); err != nil {
+			return nil, err
+		}
+		if comment.Status == commentDead {
+			comment.Content = ""
+		}
+		comment.PostID = postID
+		comment.ParentID = nullableInt(parentID)
+		comment.AuthorID = nullableInt(authorID)
+		if editedAt.Valid {
+			comment.EditedAt = &editedAt.Time
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// countDeadComments is set from COUNT_DEAD_COMMENTS at startup
+var countDeadComments = true
+
+// countedComments returns the condition on comments c that keeps dead comments out of comment counts
+// It is empty when countDeadComments is set.
+func countedComments() string {
+	if countDeadComments {
+		return ""
+	}
+	return " AND c.status = '" + commentLive + "'"
+}
+
+// setCommentStatus marks a comment live or dead
+// It returns sql.ErrNoRows if the comment does not exist.
+func setCommentStatus(ctx context.Context, db *sql.DB, commentID int, status string) error {
+	res, err := db.ExecContext(ctx, "UPDATE comments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", status, commentID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res)
+}
+
+// insertPost inserts a post by authorID (nil for anonymous), shown as author, and its tags within tx and returns its ID
+// The content is stored as raw Markdown; it is rendered and sanitized on display.
+func insertPost(ctx context.Context, tx *sql.Tx, title, content, link string, tags []string, authorID *int, author string) (int, error) {
+	var id int
+	if err := tx.QueryRowContext(ctx, "INSERT INTO posts (title, slug, type, content, link, host, link_key, author_id, author, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) RETURNING id",
+		title, slugify(title), postType(link), content, link, linkHost(link), normalizeURL(link), authorID, author).Scan(&id); err != nil {
+		return 0, err
+	}
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO post_tags (post_id, tag) VALUES ($1, $2)", id, tag); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// buildCommentTree nests replies under their parent comments
+// Top-level comments and replies keep the order of the input slice.
+// Replies whose parent is missing from the slice are treated as top-level.
+func buildCommentTree(comments []Comment) []Comment {
+	present := make(map[int]bool, len(comments))
+	for _, comment := range comments {
+		present[comment.ID] = true
+	}
+	children := make(map[int][]Comment)
+	var roots []Comment
+	for _, comment := range comments {
+		if comment.ParentID != nil && present[*comment.ParentID] {
+			children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+
+	var attach func(nodes []Comment) []Comment
+	attach = func(nodes []Comment) []Comment {
+		for i := range nodes {
+			nodes[i].Replies = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+	return attach(roots)
+}
+
+// lastCommentChange returns the latest time a comment on a post was written, edited or moderated
+// The time is zero if the post has no comments.
+func lastCommentChange(ctx context.Context, db *sql.DB, postID int) (time.Time, error) {
+	var latest time.Time
+	err := db.QueryRowContext(ctx, "SELECT updated_at FROM comments WHERE post_id = $1 ORDER BY updated_at DESC LIMIT 1", postID).Scan(&latest)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+	return latest, nil
+}
+
+// getCommentPostID returns the ID of the post a comment belongs to
+// It returns sql.ErrNoRows if the comment does not exist.
+func getCommentPostID(ctx context.Context, db *sql.DB, commentID int) (int, error) {
+	var postID int
+	err := db.QueryRowContext(ctx, "SELECT post_id FROM comments WHERE id = $1", commentID).Scan(&postID)
+	return postID, err
+}
+
+// getCommentOwner returns the ID of the post a comment belongs to and the ID of its author
+// The author ID is nil for anonymous comments. It returns sql.ErrNoRows if the comment does not exist.
+func getCommentOwner(ctx context.Context, db *sql.DB, commentID int) (int, *int, error) {
+	var postID int
+	var authorID sql.NullInt64
+	err := db.QueryRowContext(ctx, "SELECT post_id, author_id FROM comments WHERE id = $1", commentID).Scan(&postID, &authorID)
+	return postID, nullableInt(authorID), err
+}
+
+// getPostAuthorID returns the ID of the user who submitted a live post, or nil for anonymous posts
+// It returns sql.ErrNoRows if the post does not exist or is deleted.
+func getPostAuthorID(ctx context.Context, db *sql.DB, id int) (*int, error) {
+	var authorID sql.NullInt64
+	err := db.QueryRowContext(ctx, "SELECT author_id FROM posts WHERE id = $1 AND deleted_at IS NULL", id).Scan(&authorID)
+	return nullableInt(authorID), err
+}
+
+// commentAncestors returns the ID of a comment followed by the IDs of its parent,
+// grandparent and so on up to the top-level comment of its thread
+func commentAncestors(ctx context.Context, db *sql.DB, commentID int) ([]int, error) {
+	rows, err := db.QueryContext(ctx, `
+        WITH RECURSIVE chain (id, parent_id, depth) AS (
+            SELECT id, parent_id, 0 FROM comments WHERE id = $1
+            UNION ALL
+            SELECT c.id, c.parent_id, chain.depth + 1 FROM comments c JOIN chain ON c.id = chain.parent_id
+        )
+        SELECT id FROM chain ORDER BY depth
+    `, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// commentPage returns the page of its post's comments in defaultCommentSort that a comment is shown on
+// Pages hold perPage top-level comments, so a reply is on the page of the top of its thread.
+func commentPage(ctx context.Context, db *sql.DB, commentID, perPage int) (int, error) {
+	chain, err := commentAncestors(ctx, db, commentID)
+	if err != nil {
+		return 0, err
+	}
+	if len(chain) == 0 {
+		return 0, sql.ErrNoRows
+	}
+	// Count the top-level comments up to and including the root of the thread
+	var position int
+	err = db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM comments r JOIN comments root ON root.id = $1
+        WHERE r.post_id = root.post_id AND r.parent_id IS NULL
+            AND (r.created_at < root.created_at OR (r.created_at = root.created_at AND r.id <= root.id))
+    `, chain[len(chain)-1]).Scan(&position)
+	if err != nil {
+		return 0, err
+	}
+	return (position-1)/perPage + 1, nil
+}
+
+// replyParent returns the comment a reply to parentID is attached to so threads
+// stay at most maxDepth levels deep, counting top-level comments as depth 1
+// Replies that would go deeper attach to the deepest ancestor that still leaves
+// room for them; nil means the reply becomes a top-level comment.
+func replyParent(ctx context.Context, db *sql.DB, parentID, maxDepth int) (*int, error) {
+	chain, err := commentAncestors(ctx, db, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	// chain[i] sits at depth len(chain)-i, and the reply goes one level below it
+	skip := len(chain) + 1 - maxDepth
+	if skip <= 0 {
+		return &parentID, nil
+	}
+	if skip >= len(chain) {
+		return nil, nil
+	}
+	return &chain[skip], nil
+}
+
+// createComment inserts a new comment by authorID (nil for anonymous), shown as author, on a post,
+// optionally as a reply to parentID, and returns its ID
+// The content is sanitized before it is stored.
+// It returns sql.ErrNoRows if the post does not exist or is deleted.
+func createComment(ctx context.Context, db *sql.DB, postID int, parentID *int, content string, authorID *int, author string) (int, error) {
+	var id int
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRowContext(ctx, "SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL", postID).Scan(&exists); err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, "INSERT INTO comments (content, post_id, parent_id, author_id, author, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) RETURNING id",
+			sanitizeContent(content), postID, parentID, authorID, author).Scan(&id)
+	})
+	return id, err
+}
+
+// updateComment replaces the content of a comment posted less than window ago and marks it as edited
+// The content is sanitized before it is stored, like in createComment.
+// It returns sql.ErrNoRows if the comment does not exist, is dead or the edit window has passed.
+func updateComment(ctx context.Context, db *sql.DB, commentID int, content string, window time.Duration) error {
+	res, err := db.ExecContext(ctx, dialectQuery(db,
+		"UPDATE comments SET content = $1, edited_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND status = 'live' AND created_at > LOCALTIMESTAMP - $3 * INTERVAL '1 second'",
+		"UPDATE comments SET content = $1, edited_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND status = 'live' AND created_at > datetime('now', '-' || $3 || ' seconds')",
+	), sanitizeContent(content), commentID, int(window.Seconds()))
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res)
+}
+
+// errEditConflict is returned by updatePost when the post changed after the edit form was loaded
+var errEditConflict = errors.New("post was changed since it was loaded")
+
+// updatePost replaces the title, content and link of a post and regenerates its slug
+// The update only applies if the post is still at version, which is then bumped,
+// so concurrent edits can't silently overwrite each other.
+// It returns sql.ErrNoRows if the post does not exist and errEditConflict if the
+// version is outdated. The content is stored as raw Markdown.
+func updatePost(ctx context.Context, db *sql.DB, id int, version int, title, content, link string) error {
+	res, err := db.ExecContext(ctx, "UPDATE posts SET title = $1, slug = $2, type = $3, content = $4, link = $5, host = $6, link_key = $7, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = $8 AND version = $9 AND deleted_at IS NULL",
+		title, slugify(title), postType(link), content, link, linkHost(link), normalizeURL(link), id, version)
+	if err != nil {
+		return err
+	}
+	if err := requireRowsAffected(res); err != sql.ErrNoRows {
+		return err
+	}
+	// Nothing matched: tell a missing post apart from a stale version
+	var exists int
+	if err := db.QueryRowContext(ctx, "SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL", id).Scan(&exists); err != nil {
+		return err
+	}
+	return errEditConflict
+}
+
+// deletePost soft-deletes a post by setting its deleted_at time
+// The row and its comments, votes and tags are kept so restorePost can bring it back;
+// listings and lookups skip deleted posts.
+// It returns sql.ErrNoRows if the post does not exist or is already deleted.
+func deletePost(ctx context.Context, db *sql.DB, id int) error {
+	return setPostDeleted(ctx, db, id, true)
+}
+
+// restorePost undoes deletePost
+// It returns sql.ErrNoRows if the post does not exist or is not deleted.
+func restorePost(ctx context.Context, db *sql.DB, id int) error {
+	return setPostDeleted(ctx, db, id, false)
+}
+
+// setPostDeleted soft-deletes or restores a post and moves its points out of or back into the author's karma
+// It returns sql.ErrNoRows if the post does not exist or is already in the requested state.
+func setPostDeleted(ctx context.Context, db *sql.DB, id int, deleted bool) error {
+	query, sign := "UPDATE posts SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", 1
+	if deleted {
+		query, sign = "UPDATE posts SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL", -1
+	}
+	return withTx(ctx, db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+		if err := requireRowsAffected(res); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE users SET karma = karma + $1 * (SELECT points FROM posts WHERE id = $2) WHERE id = (SELECT author_id FROM posts WHERE id = $2)", sign, id)
+		return err
+	})
+}
+
+// deleteComment removes a comment from a post
+// Replies to the comment are moved up to its parent so the rest of the thread is kept.
+// It returns sql.ErrNoRows if the comment does not exist.
+func deleteComment(ctx context.Context, db *sql.DB, commentID int) error {
+	return withTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE comments SET parent_id = (SELECT parent_id FROM comments WHERE id = $1), updated_at = CURRENT_TIMESTAMP WHERE parent_id = $1", commentID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM flags WHERE target_type = $1 AND target_id = $2", flagTargetComment, commentID); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE id = $1", commentID)
+		if err != nil {
+			return err
+		}
+		return requireRowsAffected(res)
+	})
+}
+
+// requireRowsAffected returns sql.ErrNoRows if a statement matched no rows
+func requireRowsAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// linkHost returns the host shown next to a post title, without a "www." prefix
+// Links that cannot be parsed get an empty host and a logged warning.
+func linkHost(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		slog.Warn("Cannot parse post link", "link", link, "error", err)
+		return ""
+	}
+	return normalizeHost(u.Hostname())
+}
+
+// normalizeHost lowercases a host name and strips a leading "www."
+// Hosts are stored and matched in this form so www.Example.com and
+// example.com count as the same site.
+func normalizeHost(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
+
+// postType infers the type of a post from its link: text posts have none
+func postType(link string) string {
+	if link == "" {
+		return postTypeText
+	}
+	return postTypeLink
+}
+
+// nullableInt converts a nullable integer column into an *int
+func nullableInt(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// newTestDB returns a migrated SQLite database in a temporary directory, closed when the test ends
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(driverSQLite, "file:"+filepath.Join(t.TempDir(), "test.db")+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := migrate(context.Background(), db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// countingConnector opens SQLite connections that count the statements sent through them
+// Driver still returns the SQLite driver, so dialect checks see SQLite.
+type countingConnector struct {
+	dsn        string
+	driver     *sqlite.Driver
+	statements *atomic.Int64
+}
+
+func (cc countingConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := cc.driver.Open(cc.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn, cc.statements}, nil
+}
+
+func (cc countingConnector) Driver() driver.Driver { return cc.driver }
+
+// countingConn counts each query, exec and prepared statement before handing it to the SQLite connection
+type countingConn struct {
+	driver.Conn
+	statements *atomic.Int64
+}
+
+func (c countingConn) Prepare(query string) (driver.Stmt, error) {
+	c.statements.Add(1)
+	return c.Conn.Prepare(query)
+}
+
+func (c countingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	c.statements.Add(1)
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+}
+
+func (c countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.statements.Add(1)
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.statements.Add(1)
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c countingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+// newCountingTestDB returns a database like newTestDB along with the number of statements run on it
+func newCountingTestDB(t *testing.T) (*sql.DB, *atomic.Int64) {
+	t.Helper()
+	statements := new(atomic.Int64)
+	db := sql.OpenDB(countingConnector{
+		dsn:        "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)",
+		driver:     &sqlite.Driver{},
+		statements: statements,
+	})
+	t.Cleanup(func() { db.Close() })
+	if err := migrate(context.Background(), db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db, statements
+}
+
+// testUser creates a user and returns its ID
+func testUser(t *testing.T, db *sql.DB, username string) int {
+	t.Helper()
+	user, err := createUser(context.Background(), db, username, "password123", "")
+	if err != nil {
+		t.Fatalf("create user %q: %v", username, err)
+	}
+	return user.ID
+}
+
+// testPost inserts a post by authorID and returns its ID
+func testPost(t *testing.T, db *sql.DB, title, link string, authorID *int) int {
+	t.Helper()
+	var id int
+	err := withTx(context.Background(), db, func(tx *sql.Tx) error {
+		var err error
+		id, err = insertPost(context.Background(), tx, title, "text of "+title, link, nil, authorID, anonymousAuthor)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("insert post %q: %v", title, err)
+	}
+	return id
+}
+
+// testComment inserts a comment on a post, as a reply when parentID is not nil, and returns its ID
+func testComment(t *testing.T, db *sql.DB, postID int, parentID *int) int {
+	t.Helper()
+	id, err := createComment(context.Background(), db, postID, parentID, "a comment", nil, anonymousAuthor)
+	if err != nil {
+		t.Fatalf("insert comment: %v", err)
+	}
+	return id
+}
+
+func TestListPostsCommentCount(t *testing.T) {
+	db, statements := newCountingTestDB(t)
+	ctx := context.Background()
+	quiet := testPost(t, db, "Quiet", "", nil)
+	busy := testPost(t, db, "Busy", "https://example.com/busy", nil)
+	testComment(t, db, busy, nil)
+	reply := testComment(t, db, busy, nil)
+	testComment(t, db, busy, &reply)
+	dead := testComment(t, db, busy, nil)
+	if err := setCommentStatus(ctx, db, dead, commentDead); err != nil {
+		t.Fatal(err)
+	}
+	other := testPost(t, db, "Other", "https://example.com/other", nil)
+	testComment(t, db, other, nil)
+
+	defer func(saved bool) { countDeadComments = saved }(countDeadComments)
+	tests := []struct {
+		name       string
+		countDead  bool
+		maxPerHost int
+		want       map[int]int
+	}{
+		{"dead comments counted", true, 0, map[int]int{quiet: 0, busy: 4, other: 1}},
+		{"dead comments left out", false, 0, map[int]int{quiet: 0, busy: 3, other: 1}},
+		{"capped per site", true, 1, map[int]int{quiet: 0, busy: 4, other: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			countDeadComments = tt.countDead
+			statements.Store(0)
+			posts, err := listPosts(ctx, db, postListOptions{Sort: sortNew, MaxPerHost: tt.maxPerHost, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The counts come with the posts; the only other query loads the tags of the whole page
+			if n := statements.Load(); n != 2 {
+				t.Errorf("listPosts ran %d statements for %d posts, want 2", n, len(posts))
+			}
+			if len(posts) != len(tt.want) {
+				t.Fatalf("got %d posts, want %d", len(posts), len(tt.want))
+			}
+			for _, p := range posts {
+				if p.CommentCount != tt.want[p.ID] {
+					t.Errorf("post %q has CommentCount %d, want %d", p.Title, p.CommentCount, tt.want[p.ID])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateComment(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	live := testPost(t, db, "Live", "", nil)
+	deleted := testPost(t, db, "Deleted", "", nil)
+	if err := deletePost(ctx, db, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		postID     int
+		wantErr    error
+		wantStored int
+	}{
+		{"live post", live, nil, 1},
+		{"deleted post", deleted, sql.ErrNoRows, 0},
+		{"missing post", deleted + 1, sql.ErrNoRows, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := createComment(ctx, db, tt.postID, nil, "a comment", nil, anonymousAuthor); err != tt.wantErr {
+				t.Fatalf("createComment = %v, want %v", err, tt.wantErr)
+			}
+			var n int
+			if err := db.QueryRow("SELECT COUNT(*) FROM comments WHERE post_id = $1", tt.postID).Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.wantStored {
+				t.Errorf("%d comments stored, want %d", n, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestDeleteComment(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	post := testPost(t, db, "Thread", "", nil)
+	// top -> middle -> {leaf, other}
+	top := testComment(t, db, post, nil)
+	middle := testComment(t, db, post, &top)
+	leaf := testComment(t, db, post, &middle)
+	other := testComment(t, db, post, &middle)
+
+	tests := []struct {
+		name    string
+		delete  int
+		wantErr error
+		// wantParents maps every remaining comment to its parent, 0 for top-level
+		wantParents map[int]int
+	}{
+		{"replies move up to the grandparent", middle, nil, map[int]int{top: 0, leaf: top, other: top}},
+		{"replies to a top-level comment become top-level", top, nil, map[int]int{leaf: 0, other: 0}},
+		{"leaf", leaf, nil, map[int]int{other: 0}},
+		{"already deleted", leaf, sql.ErrNoRows, map[int]int{other: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := deleteComment(ctx, db, tt.delete); err != tt.wantErr {
+				t.Fatalf("deleteComment(%d) = %v, want %v", tt.delete, err, tt.wantErr)
+			}
+			comments, err := listComments(ctx, db, post, commentSortOld)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[int]int, len(comments))
+			for _, c := range comments {
+				got[c.ID] = 0
+				if c.ParentID != nil {
+					got[c.ID] = *c.ParentID
+				}
+			}
+			if len(got) != len(tt.wantParents) {
+				t.Fatalf("remaining comments %v, want %v", got, tt.wantParents)
+			}
+			for id, parent := range tt.wantParents {
+				if p, ok := got[id]; !ok || p != parent {
+					t.Errorf("comment %d: parent %d (present %v), want %d", id, p, ok, parent)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateComment(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	post := testPost(t, db, "Edits", "", nil)
+	fresh := testComment(t, db, post, nil)
+	old := testComment(t, db, post, nil)
+	if _, err := db.Exec("UPDATE comments SET created_at = datetime('now', '-2 hours') WHERE id = $1", old); err != nil {
+		t.Fatal(err)
+	}
+	dead := testComment(t, db, post, nil)
+	if err := setCommentStatus(ctx, db, dead, commentDead); err != nil {
+		t.Fatal(err)
+	}
+	const window = time.Hour
+
+	tests := []struct {
+		name    string
+		id      int
+		content string
+		wantErr error
+		want    string
+	}{
+		{"within the window", fresh, "fixed a typo", nil, "fixed a typo"},
+		{"content is sanitized", fresh, `<b onclick="x()">bold</b><script>alert(1)</script>`, nil, "<b>bold</b>"},
+		{"window has passed", old, "too late", sql.ErrNoRows, "a comment"},
+		{"dead comment", dead, "revived", sql.ErrNoRows, "a comment"},
+		{"missing comment", dead + 1, "nothing", sql.ErrNoRows, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := updateComment(ctx, db, tt.id, tt.content, window); err != tt.wantErr {
+				t.Fatalf("updateComment = %v, want %v", err, tt.wantErr)
+			}
+			var content string
+			var editedAt sql.NullTime
+			err := db.QueryRow("SELECT content, edited_at FROM comments WHERE id = $1", tt.id).Scan(&content, &editedAt)
+			if err == sql.ErrNoRows && tt.want == "" {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content != tt.want {
+				t.Errorf("content = %q, want %q", content, tt.want)
+			}
+			if editedAt.Valid != (tt.wantErr == nil) {
+				t.Errorf("edited_at set = %v, want %v", editedAt.Valid, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestReplyParent(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	post := testPost(t, db, "Deep thread", "", nil)
+	// A thread four levels deep, as it could be from before a lower limit was set
+	depth1 := testComment(t, db, post, nil)
+	depth2 := testComment(t, db, post, &depth1)
+	depth3 := testComment(t, db, post, &depth2)
+	depth4 := testComment(t, db, post, &depth3)
+
+	tests := []struct {
+		name     string
+		parentID int
+		maxDepth int
+		want     int // 0 for a top-level comment
+	}{
+		{"room below the parent", depth1, 3, depth1},
+		{"reply lands at the deepest level", depth2, 3, depth2},
+		{"replying at the deepest level attaches to the parent's parent", depth3, 3, depth2},
+		{"thread already deeper than the limit", depth4, 3, depth2},
+		{"generous limit", depth4, 10, depth4},
+		{"limit of two", depth4, 2, depth1},
+		{"flat threads make every reply top-level", depth2, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := replyParent(ctx, db, tt.parentID, tt.maxDepth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotID := 0
+			if got != nil {
+				gotID = *got
+			}
+			if gotID != tt.want {
+				t.Errorf("replyParent(%d, %d) = %d, want %d", tt.parentID, tt.maxDepth, gotID, tt.want)
+			}
+		})
+	}
+
+	if _, err := replyParent(ctx, db, depth4+1, 3); err != sql.ErrNoRows {
+		t.Errorf("reply to a missing comment: %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestListPostsPerHost(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	// Oldest first; each post is a minute newer than the one before
+	seed := []struct{ title, link string }{
+		{"a1", "https://a.example/1"},
+		{"b1", "https://b.example/1"},
+		{"a2", "https://a.example/2"},
+		{"text", ""},
+		{"a3", "https://www.a.example/3"},
+		{"a4", "https://a.example/4"},
+	}
+	for i, s := range seed {
+		id := testPost(t, db, s.title, s.link, nil)
+		if _, err := db.Exec("UPDATE posts SET created_at = datetime('now', '-' || $1 || ' minutes') WHERE id = $2", len(seed)-i, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		maxPerHost int
+		limit      int
+		offset     int
+		want       []string
+	}{
+		{"no cap", 0, 10, 0, []string{"a4", "a3", "text", "a2", "b1", "a1"}},
+		{"two per site", 2, 10, 0, []string{"a4", "a3", "text", "b1", "a2", "a1"}},
+		{"one per site", 1, 10, 0, []string{"a4", "text", "b1", "a3", "a2", "a1"}},
+		{"cap above the busiest site", 4, 10, 0, []string{"a4", "a3", "text", "a2", "b1", "a1"}},
+		{"paging keeps the capped order", 1, 2, 2, []string{"b1", "a3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts, err := listPosts(ctx, db, postListOptions{Sort: sortNew, MaxPerHost: tt.maxPerHost, Limit: tt.limit, Offset: tt.offset})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range posts {
+				got = append(got, p.Title)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListPostsMaxFlags(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	const threshold = 2
+	for _, s := range []struct {
+		title string
+		flags int
+	}{{"unflagged", 0}, {"at the threshold", threshold}, {"over the threshold", threshold + 1}} {
+		id := testPost(t, db, s.title, "", nil)
+		if _, err := db.Exec("UPDATE posts SET flag_count = $1 WHERE id = $2", s.flags, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		maxFlags int
+		want     []string
+	}{
+		{"no threshold", 0, []string{"at the threshold", "over the threshold", "unflagged"}},
+		{"posts over the threshold hidden", threshold, []string{"at the threshold", "unflagged"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts, err := listPosts(ctx, db, postListOptions{Sort: sortNew, MaxFlags: tt.maxFlags, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range posts {
+				got = append(got, p.Title)
+			}
+			// The posts share a creation time, so only which ones are listed matters
+			slices.Sort(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// profileListSize is the number of posts and comments shown on a profile
+const profileListSize = 30
+
+// registerProfileRoutes registers the public user profile pages
+func registerProfileRoutes(r *gin.Engine, db *sql.DB) {
+	// Route to display a user's join date, karma and latest posts and comments
+	r.GET("/user/:username", func(c *gin.Context) {
+		user, err := getUserByUsername(c.Request.Context(), db, c.Param("username"))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				renderNotFound(c, "There is no user with that name.")
+			} else {
+				serverError(c, err)
+			}
+			return
+		}
+
+		posts, err := listPosts(c.Request.Context(), db, postListOptions{Sort: sortNew, AuthorID: user.ID, Limit: profileListSize})
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		comments, err := listUserComments(c.Request.Context(), db, user.ID, profileListSize)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		renderTemplate(c, "profile.html", map[string]interface{}{
+			"User":     user,
+			"Posts":    posts,
+			"Comments": comments,
+		})
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// randomPostID returns the ID of a random live post, or sql.ErrNoRows if there are none
+// Instead of sorting the whole table with ORDER BY RANDOM(), it picks a random
+// point in the ID range and takes the first live post at or after it, which
+// costs two index lookups. Posts after large gaps in the IDs are picked more often.
+func randomPostID(ctx context.Context, db *sql.DB) (int, error) {
+	var lo, hi sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT MIN(id), MAX(id) FROM posts WHERE deleted_at IS NULL").Scan(&lo, &hi); err != nil {
+		return 0, err
+	}
+	if !lo.Valid {
+		return 0, sql.ErrNoRows
+	}
+	start := lo.Int64 + rand.Int64N(hi.Int64-lo.Int64+1)
+	var id int
+	err := db.QueryRowContext(ctx, "SELECT id FROM posts WHERE id >= $1 AND deleted_at IS NULL ORDER BY id LIMIT 1", start).Scan(&id)
+	return id, err
+}
+
+// registerRandomRoutes registers the random post route
+func registerRandomRoutes(r *gin.Engine, db *sql.DB) {
+	// Route to jump to a random post
+	r.GET("/random", func(c *gin.Context) {
+		id, err := randomPostID(c.Request.Context(), db)
+		if err == sql.ErrNoRows {
+			c.Redirect(http.StatusFound, "/?notice="+noticeNoPosts)
+			return
+		}
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		c.Redirect(http.StatusFound, "/post/"+strconv.Itoa(id))
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// Orderings available for post listings
+const (
+	sortHot = "hot" // HN-style ranking that favors recent, upvoted posts
+	sortNew = "new" // Newest first
+	sortTop = "top" // Most points first
+)
+
+// defaultSort is the listing order used when none is requested
+const defaultSort = sortHot
+
+// validSort reports whether s names one of the listing orders
+func validSort(s string) bool {
+	switch s {
+	case sortHot, sortNew, sortTop:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseSort validates a requested ordering, falling back to defaultSort for unknown values
+func parseSort(s string) string {
+	if validSort(s) {
+		return s
+	}
+	return defaultSort
+}
+
+// orderByClause returns the ORDER BY expression for a listing order on the posts table aliased as p
+// The hot ordering uses the hot_score stored by recomputeHotScores.
+func orderByClause(sort string) string {
+	switch sort {
+	case sortHot:
+		return "p.hot_score DESC, p.created_at DESC"
+	case sortNew:
+		return "p.created_at DESC"
+	default:
+		return "p.points DESC, p.created_at DESC"
+	}
+}
+
+// hotScoreExpr returns the SQL expression computing the hot score of a row in posts
+//
+// The hot ranking follows Hacker News: score = (points - 1) / (age_hours + 2)^1.8,
+// where the 1.8 "gravity" controls how quickly posts sink as they age.
+// HN counts the submitter's own vote, so its posts start at 1 point; ours start
+// at 0, which means our points already equal HN's "points - 1".
+func hotScoreExpr(db *sql.DB) string {
+	return dialectQuery(db,
+		"points / POWER(EXTRACT(EPOCH FROM (LOCALTIMESTAMP - created_at)) / 3600 + 2, 1.8)",
+		"points / POWER((julianday('now') - julianday(created_at)) * 24 + 2, 1.8)",
+	)
+}
+
+// recomputeHotScores refreshes the stored hot score of every live post in one statement
+// Scores decay with age, so this must run periodically for the hot ordering to stay current.
+func recomputeHotScores(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "UPDATE posts SET hot_score = "+hotScoreExpr(db)+" WHERE deleted_at IS NULL")
+	return err
+}
+
+// runHotScores recomputes hot scores right away and then every interval until ctx is cancelled
+func runHotScores(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := recomputeHotScores(ctx, db); err != nil && ctx.Err() == nil {
+			slog.Error("Cannot recompute hot scores", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Orderings available for comment threads
+const (
+	commentSortOld = "old" // Oldest first, like HN
+	commentSortNew = "new" // Newest first
+)
+
+// defaultCommentSort is the comment order used when none is requested
+const defaultCommentSort = commentSortOld
+
+// parseCommentSort validates a requested comment order, falling back to defaultCommentSort for unknown values
+func parseCommentSort(s string) string {
+	switch s {
+	case commentSortOld, commentSortNew:
+		return s
+	default:
+		return defaultCommentSort
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"hot", sortHot},
+		{"new", sortNew},
+		{"top", sortTop},
+		{"", defaultSort},
+		{"HOT", defaultSort},
+		{"points DESC; DROP TABLE posts", defaultSort},
+	}
+	for _, tt := range tests {
+		if got := parseSort(tt.in); got != tt.want {
+			t.Errorf("parseSort(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHotRanking(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	// Points and age in hours of each post, by title
+	seed := []struct {
+		title  string
+		points int
+		hours  int
+	}{
+		{"old favorite", 100, 48},
+		{"rising", 20, 2},
+		{"fresh", 1, 0},
+		{"day old", 10, 24},
+		{"brand new, no votes", 0, 0},
+	}
+	for _, s := range seed {
+		id := testPost(t, db, s.title, "", nil)
+		if _, err := db.ExecContext(ctx, "UPDATE posts SET points = $1, created_at = datetime('now', '-' || $2 || ' hours') WHERE id = $3", s.points, s.hours, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recomputeHotScores(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		// 20/4^1.8 = 1.65, 1/2^1.8 = 0.29, 100/50^1.8 = 0.09, 10/26^1.8 = 0.03, 0
+		{sortHot, []string{"rising", "fresh", "old favorite", "day old", "brand new, no votes"}},
+		{sortTop, []string{"old favorite", "rising", "day old", "fresh", "brand new, no votes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			posts, err := listPosts(ctx, db, postListOptions{Sort: tt.sort, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range posts {
+				got = append(got, p.Title)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimitCleanupInterval is how often idle client entries are swept
+	rateLimitCleanupInterval = time.Minute
+	// rateLimitIdleTTL is how long a client may be idle before its entry is dropped
+	rateLimitIdleTTL = 10 * time.Minute
+)
+
+// clientLimiter is the token bucket for a single client IP
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter hands out a token bucket per client IP
+type rateLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+	limit   rate.Limit
+	burst   int
+}
+
+// newRateLimiter returns a limiter allowing perMinute requests per client, with bursts of up to burst
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{
+		clients: make(map[string]*clientLimiter),
+		limit:   rate.Limit(float64(perMinute) / 60),
+		burst:   burst,
+	}
+}
+
+// get returns the token bucket for ip, creating it on first use
+func (l *rateLimiter) get(ip string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	client, ok := l.clients[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = client
+	}
+	client.lastSeen = time.Now()
+	return client.limiter
+}
+
+// cleanup drops clients that have been idle longer than rateLimitIdleTTL
+// A dropped client simply starts again with a full bucket on its next request.
+func (l *rateLimiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ip, client := range l.clients {
+		if time.Since(client.lastSeen) > rateLimitIdleTTL {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// runCleanup periodically sweeps idle clients until ctx is cancelled
+func (l *rateLimiter) runCleanup(ctx context.Context) {
+	ticker := time.NewTicker(rateLimitCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.cleanup()
+		}
+	}
+}
+
+// middleware throttles POST requests per client IP, responding 429 when the bucket is empty
+// The client IP comes from c.ClientIP, which honors X-Forwarded-For from trusted proxies.
+func (l *rateLimiter) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+		limiter := l.get(c.ClientIP())
+		if !limiter.Allow() {
+			// Seconds until the bucket refills by one token
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(1/float64(l.limit)))))
+			const msg = "Too many requests, please slow down"
+			if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+				abortJSON(c, http.StatusTooManyRequests, errCodeRateLimited, msg)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": msg})
+			return
+		}
+		c.Next()
+	}
+}
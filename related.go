@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// relatedPostsLimit is the number of related posts shown under a post
+	relatedPostsLimit = 5
+	// relatedPostsWindow bounds the search for related posts to those submitted this recently
+	relatedPostsWindow = 90 * 24 * time.Hour
+)
+
+// listRelatedPosts returns up to limit recent posts sharing a tag or the host of post
+// Matches come newest first from posts submitted within relatedPostsWindow,
+// which keeps the lookup on the tag and host indexes bounded. When nothing
+// matches, for example because the post has neither tags nor a link, the
+// newest other posts are returned instead. Posts with more than maxFlags flags
+// are left out, like on the front page.
+func listRelatedPosts(ctx context.Context, db *sql.DB, post *Post, limit, maxFlags int) ([]Post, error) {
+	var posts []Post
+	if len(post.Tags) > 0 || post.Host != "" {
+		args := []interface{}{post.ID, int(relatedPostsWindow.Seconds())}
+		var matches []string
+		if post.Host != "" {
+			args = append(args, post.Host)
+			matches = append(matches, fmt.Sprintf("p.host = $%d", len(args)))
+		}
+		if len(post.Tags) > 0 {
+			placeholders := make([]string, len(post.Tags))
+			for i, tag := range post.Tags {
+				args = append(args, tag)
+				placeholders[i] = fmt.Sprintf("$%d", len(args))
+			}
+			matches = append(matches, "p.id IN (SELECT post_id FROM post_tags WHERE tag IN ("+strings.Join(placeholders, ", ")+"))")
+		}
+		flagged := ""
+		if maxFlags > 0 {
+			args = append(args, maxFlags)
+			flagged = fmt.Sprintf(" AND p.flag_count <= $%d", len(args))
+		}
+		args = append(args, limit)
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+            SELECT `+postColumns+`,
+                (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id`+countedComments()+`) -- Comment count
+            FROM posts p
+            WHERE p.deleted_at IS NULL AND p.id <> $1 AND p.created_at > %s%s AND (%s)
+            ORDER BY p.created_at DESC
+            LIMIT $%d
+        `, dialectQuery(db, "LOCALTIMESTAMP - $2 * INTERVAL '1 second'", "datetime('now', '-' || $2 || ' seconds')"),
+			flagged, strings.Join(matches, " OR "), len(args)), args...)
+		if err != nil {
+			return nil, err
+		}
+		if posts, err = scanPosts(rows); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(posts) == 0 {
+		// One extra in case the post itself is among the newest
+		recent, err := listPosts(ctx, db, postListOptions{Sort: sortNew, MaxFlags: maxFlags, Limit: limit + 1})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range recent {
+			if p.ID != post.ID && len(posts) < limit {
+				posts = append(posts, p)
+			}
+		}
+		return posts, nil
+	}
+	return posts, attachTags(ctx, db, posts)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"html"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// allowedTags lists the HTML elements kept by sanitizeContent
+// All attributes are dropped except href on links.
+var allowedTags = map[string]bool{
+	"a":          true,
+	"b":          true,
+	"blockquote": true,
+	"br":         true,
+	"code":       true,
+	"em":         true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"hr":         true,
+	"i":          true,
+	"li":         true,
+	"ol":         true,
+	"p":          true,
+	"pre":        true,
+	"strong":     true,
+	"ul":         true,
+}
+
+// droppedContentTags lists elements whose content is removed along with the tag.
+// These are the elements the HTML tokenizer reads as raw text, so keeping their
+// content could smuggle markup past the sanitizer.
+var droppedContentTags = map[string]bool{
+	"iframe":    true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"plaintext": true,
+	"script":    true,
+	"style":     true,
+	"textarea":  true,
+	"title":     true,
+	"xmp":       true,
+}
+
+// sanitizeContent strips dangerous markup from user-submitted content
+// Tags outside the allowlist are removed, event handler and style attributes
+// are dropped, and links are limited to http, https and mailto URLs.
+// Plain text, including markdown-ish punctuation, is left untouched.
+func sanitizeContent(s string) string {
+	var b strings.Builder
+	z := nethtml.NewTokenizer(strings.NewReader(s))
+	skipping := ""
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			// io.EOF or malformed input; either way we keep what we have
+			return b.String()
+		}
+		// Raw must be copied before Token, which unescapes the buffer in place
+		raw := append([]byte(nil), z.Raw()...)
+		tok := z.Token()
+		if skipping != "" {
+			if tt == nethtml.EndTagToken && tok.Data == skipping {
+				skipping = ""
+			}
+			continue
+		}
+		switch tt {
+		case nethtml.TextToken:
+			b.Write(raw)
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			if droppedContentTags[tok.Data] {
+				if tt == nethtml.StartTagToken {
+					skipping = tok.Data
+				}
+				continue
+			}
+			if !allowedTags[tok.Data] {
+				continue
+			}
+			b.WriteString("<" + tok.Data)
+			if tok.Data == "a" {
+				for _, attr := range tok.Attr {
+					if attr.Key == "href" && isSafeHref(attr.Val) {
+						b.WriteString(` href="` + html.EscapeString(attr.Val) + `" rel="nofollow"`)
+						break
+					}
+				}
+			}
+			b.WriteString(">")
+		case nethtml.EndTagToken:
+			if allowedTags[tok.Data] {
+				b.WriteString("</" + tok.Data + ">")
+			}
+		}
+	}
+}
+
+// isSafeHref reports whether a link target uses an allowed scheme
+func isSafeHref(href string) bool {
+	href = strings.ToLower(strings.TrimSpace(href))
+	return strings.HasPrefix(href, "http://") ||
+		strings.HasPrefix(href, "https://") ||
+		strings.HasPrefix(href, "mailto:")
+}
+
+// inlineTags lists elements that stripHTML removes without separating the
+// surrounding words; any other tag is treated as a break between words
+var inlineTags = map[string]bool{
+	"a":      true,
+	"b":      true,
+	"code":   true,
+	"em":     true,
+	"i":      true,
+	"span":   true,
+	"strong": true,
+}
+
+// stripHTML returns the plain text of s with all markup removed and whitespace collapsed,
+// for previews and other places where tags would show up literally
+// Entities are decoded, so the result must be escaped again before it is written as HTML.
+func stripHTML(s string) string {
+	var b strings.Builder
+	z := nethtml.NewTokenizer(strings.NewReader(s))
+	skipping := ""
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			return strings.Join(strings.Fields(b.String()), " ")
+		}
+		tok := z.Token()
+		if skipping != "" {
+			if tt == nethtml.EndTagToken && tok.Data == skipping {
+				skipping = ""
+			}
+			continue
+		}
+		switch tt {
+		case nethtml.TextToken:
+			b.WriteString(tok.Data)
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken, nethtml.EndTagToken:
+			if tt == nethtml.StartTagToken && droppedContentTags[tok.Data] {
+				skipping = tok.Data
+			}
+			if !inlineTags[tok.Data] {
+				b.WriteString(" ")
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestSanitizeContent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text", "Hello, world", "Hello, world"},
+		{"markdown punctuation", "**bold** _it_ 1 < 2 > 0 & `code`", "**bold** _it_ 1 < 2 > 0 & `code`"},
+		{"allowed tags kept", "<p>a <b>b</b> <em>c</em></p>", "<p>a <b>b</b> <em>c</em></p>"},
+		{"unknown tags removed", "<div><span>text</span></div>", "text"},
+		{"script and its content removed", "before<script>alert(1)</script>after", "beforeafter"},
+		{"style and its content removed", "<style>body{display:none}</style>ok", "ok"},
+		{"event handlers dropped", `<b onclick="steal()">x</b>`, "<b>x</b>"},
+		{"style attribute dropped", `<p style="position:fixed">x</p>`, "<p>x</p>"},
+		{"safe link kept", `<a href="https://example.com/?a=1&b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2" rel="nofollow">x</a>`},
+		{"mailto link kept", `<a href="mailto:me@example.com">mail</a>`, `<a href="mailto:me@example.com" rel="nofollow">mail</a>`},
+		{"javascript link loses href", `<a href="javascript:alert(1)">x</a>`, "<a>x</a>"},
+		{"mixed case javascript link", `<a href=" JaVaScRiPt:alert(1)">x</a>`, "<a>x</a>"},
+		{"image dropped", `<img src=x onerror=alert(1)>`, ""},
+		{"iframe dropped", `<iframe src="https://evil.example"></iframe>ok`, "ok"},
+		{"escaped markup stays escaped", "&lt;script&gt;", "&lt;script&gt;"},
+		{"unclosed script swallows the rest", "ok<script>alert(1)", "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeContent(tt.in); got != tt.want {
+				t.Errorf("sanitizeContent(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxSlugLength keeps generated slugs to a readable length
+const maxSlugLength = 80
+
+// reservedSlugs are the fixed path segments of routes under /post/:id/
+// A post whose slug was one of them would have its page shadowed by the route.
+var reservedSlugs = map[string]bool{
+	"edit":     true,
+	"upvote":   true,
+	"downvote": true,
+	"image":    true,
+}
+
+// slugify derives a URL slug from a post title
+// Letters and digits are lowercased, every run of other characters becomes a
+// single hyphen, and leading and trailing hyphens are dropped, so
+// "Show HN: My cool project!" becomes "show-hn-my-cool-project". Slugs that
+// match a route in reservedSlugs get a "-post" suffix.
+func slugify(title string) string {
+	var b strings.Builder
+	n := 0
+	pendingHyphen := false
+	for _, r := range title {
+		if n >= maxSlugLength {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+				n++
+			}
+			pendingHyphen = false
+			b.WriteRune(unicode.ToLower(r))
+			n++
+			continue
+		}
+		pendingHyphen = true
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if reservedSlugs[slug] {
+		slug += "-post"
+	}
+	return slug
+}
+
+// URL returns the canonical path of a post's discussion page
+func (p Post) URL() string {
+	if p.Slug == "" {
+		return "/post/" + strconv.Itoa(p.ID)
+	}
+	return "/post/" + strconv.Itoa(p.ID) + "/" + p.Slug
+}
+
+// URL returns the permalink of a comment: its post's page with an anchor to the comment
+// The post is addressed by ID, which redirects to its canonical URL and keeps the anchor.
+func (c Comment) URL() string {
+	return "/post/" + strconv.Itoa(c.PostID) + "#comment-" + strconv.Itoa(c.ID)
+}
+
+// PageURL returns the link to a comment on the given page of its post's comments
+func (c Comment) PageURL(page int) string {
+	return "/post/" + strconv.Itoa(c.PostID) + "?cpage=" + strconv.Itoa(page) + "#comment-" + strconv.Itoa(c.ID)
+}
+
+// postSlug returns the stored slug of a post, deriving it from the title for
+// posts created before slugs were stored
+func postSlug(slug, title string) string {
+	if slug == "" {
+		return slugify(title)
+	}
+	return slug
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// spamMaxLinks is the most links a post may contain before it is treated as spam
+	spamMaxLinks = 10
+	// spamCapsTitleLetters is the number of letters from which an all-caps title counts as shouting
+	spamCapsTitleLetters = 20
+)
+
+// spamKeywords are phrases that mark a submission as spam, matched case-insensitively
+// main replaces the defaults with SPAM_KEYWORDS when it is set.
+var spamKeywords = []string{"casino bonus", "payday loan", "viagra", "crypto giveaway"}
+
+// isLikelySpam reports whether a submission looks like spam
+// Each rule is deliberately conservative, since a rejected honest post costs
+// more than a spam post a moderator has to delete.
+func isLikelySpam(title, content string) bool {
+	return hasSpamKeyword(title+"\n"+content) ||
+		countLinks(content) > spamMaxLinks ||
+		isShouting(title)
+}
+
+// hasSpamKeyword reports whether s contains any of spamKeywords
+func hasSpamKeyword(s string) bool {
+	s = strings.ToLower(s)
+	for _, keyword := range spamKeywords {
+		if strings.Contains(s, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// countLinks counts the http and https URLs in s
+func countLinks(s string) int {
+	s = strings.ToLower(s)
+	return strings.Count(s, "http://") + strings.Count(s, "https://")
+}
+
+// isShouting reports whether a title of at least spamCapsTitleLetters letters has no lowercase letters
+func isShouting(title string) bool {
+	letters := 0
+	for _, r := range title {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	return letters >= spamCapsTitleLetters
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticMaxAge is how long browsers may reuse a static file before revalidating it
+const staticMaxAge = "86400"
+
+// registerStaticRoutes serves the static files and the favicon with caching headers
+// Every response carries an ETag derived from the file content, so revalidation
+// is a cheap 304 even for embedded files, which have no modification time.
+// In dev mode browsers are told to revalidate on every request.
+func registerStaticRoutes(r *gin.Engine, fsys fs.FS, dev bool) {
+	cacheControl := "public, max-age=" + staticMaxAge
+	if dev {
+		cacheControl = "no-cache"
+	}
+	serve := func(c *gin.Context, name string) {
+		if !fs.ValidPath(name) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		var modTime time.Time
+		if info, err := fs.Stat(fsys, name); err == nil {
+			modTime = info.ModTime()
+		}
+		sum := sha256.Sum256(data)
+		c.Header("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+		c.Header("Cache-Control", cacheControl)
+		http.ServeContent(c.Writer, c.Request, name, modTime, bytes.NewReader(data))
+	}
+
+	staticFile := func(c *gin.Context) {
+		serve(c, strings.TrimPrefix(c.Param("filepath"), "/"))
+	}
+	favicon := func(c *gin.Context) {
+		serve(c, "favicon.ico")
+	}
+	r.GET("/static/*filepath", staticFile)
+	r.HEAD("/static/*filepath", staticFile)
+	r.GET("/favicon.ico", favicon)
+	r.HEAD("/favicon.ico", favicon)
+}
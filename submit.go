@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// errAlreadySubmitted is returned by submitPost when a submission with an
+// attachment links to a post that already exists, since the upvote it turns
+// into cannot keep the attachment
+var errAlreadySubmitted = errors.New("link was already submitted")
+
+// submitPost adds a validated post from the new post form or the JSON API and returns its ID
+// A link that was already submitted counts as an upvote by voter of the
+// existing post, like on HN, and created is false. Otherwise the post is
+// inserted with attach, when not nil, running in the same transaction to store
+// extras such as an image.
+func submitPost(ctx context.Context, db *sql.DB, title, content, link string, tags []string, authorID *int, author, voter string, pointsFloor int, attach func(tx *sql.Tx, postID int) error) (id int, created bool, err error) {
+	if link != "" {
+		existingID, err := findPostByLink(ctx, db, link)
+		if err == nil {
+			if attach != nil {
+				return existingID, false, errAlreadySubmitted
+			}
+			if _, err := castVote(ctx, db, existingID, voter, 1, pointsFloor); err != nil {
+				return 0, false, err
+			}
+			return existingID, false, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, false, err
+		}
+	}
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		if id, err = insertPost(ctx, tx, title, content, link, tags, authorID, author); err != nil || attach == nil {
+			return err
+		}
+		return attach(tx, id)
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
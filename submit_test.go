@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestSubmitPost(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	first, created, err := submitPost(ctx, db, "Original", "", "https://example.com/story", nil, nil, anonymousAuthor, "ip:10.0.0.1", 0, nil)
+	if err != nil || !created {
+		t.Fatalf("first submission: id %d, created %v, error %v", first, created, err)
+	}
+	attached := errors.New("image stored")
+
+	tests := []struct {
+		name        string
+		link        string
+		voter       string
+		attach      func(tx *sql.Tx, postID int) error
+		wantCreated bool
+		wantErr     error
+		wantPoints  int // Points of the original post afterwards
+	}{
+		{"same link upvotes the original", "https://example.com/story", "ip:10.0.0.2", nil, false, nil, 1},
+		{"normalized duplicate", "http://www.example.com/story/?utm_source=hn", "ip:10.0.0.3", nil, false, nil, 2},
+		{"duplicate by an earlier voter is a no-op", "https://example.com/story", "ip:10.0.0.3", nil, false, nil, 2},
+		{"duplicate with an attachment is refused", "https://example.com/story", "ip:10.0.0.4", func(*sql.Tx, int) error { return nil }, false, errAlreadySubmitted, 2},
+		{"new link", "https://example.com/other", "ip:10.0.0.2", nil, true, nil, 2},
+		{"text post", "", "ip:10.0.0.2", nil, true, nil, 2},
+		{"failed attachment rolls the post back", "https://example.com/third", "ip:10.0.0.2", func(*sql.Tx, int) error { return attached }, false, attached, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := countPosts(ctx, db, postListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, created, err := submitPost(ctx, db, "Submission", "some text", tt.link, nil, nil, anonymousAuthor, tt.voter, 0, tt.attach)
+			if err != tt.wantErr {
+				t.Fatalf("submitPost error = %v, want %v", err, tt.wantErr)
+			}
+			if created != tt.wantCreated {
+				t.Errorf("created = %v, want %v", created, tt.wantCreated)
+			}
+			if err == nil && !created && id != first {
+				t.Errorf("duplicate returned post %d, want the original %d", id, first)
+			}
+			after, err := countPosts(ctx, db, postListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantAfter := before
+			if tt.wantCreated {
+				wantAfter++
+			}
+			if after != wantAfter {
+				t.Errorf("%d posts after submitting, want %d", after, wantAfter)
+			}
+			original, err := getPostByID(ctx, db, first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if original.Points != tt.wantPoints {
+				t.Errorf("original has %d points, want %d", original.Points, tt.wantPoints)
+			}
+		})
+	}
+}
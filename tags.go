@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxTagsPerPost = 5  // Most tags a single post may carry
+	maxTagLength   = 32 // Matches the VARCHAR(32) tag column
+)
+
+// parseTags splits a comma-separated tag list into normalized tags
+// Tags are trimmed and lowercased, empty entries are dropped and duplicates
+// are removed while keeping the order they were given in.
+func parseTags(s string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags must be at most %d characters", maxTagLength)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTagsPerPost {
+		return nil, fmt.Errorf("a post can have at most %d tags", maxTagsPerPost)
+	}
+	return tags, nil
+}
+
+// loadTags returns the tags of the given posts keyed by post ID
+func loadTags(ctx context.Context, db *sql.DB, postIDs ...int) (map[int][]string, error) {
+	tags := make(map[int][]string, len(postIDs))
+	if len(postIDs) == 0 {
+		return tags, nil
+	}
+	placeholders := make([]string, len(postIDs))
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	rows, err := db.QueryContext(ctx, "SELECT post_id, tag FROM post_tags WHERE post_id IN ("+strings.Join(placeholders, ", ")+") ORDER BY tag", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var tag string
+		if err := rows.Scan(&postID, &tag); err != nil {
+			return nil, err
+		}
+		tags[postID] = append(tags[postID], tag)
+	}
+	return tags, rows.Err()
+}
+
+// attachTags fills in the Tags of every post with a single query
+func attachTags(ctx context.Context, db *sql.DB, posts []Post) error {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	tags, err := loadTags(ctx, db, ids...)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Tags = tags[posts[i].ID]
+	}
+	return nil
+}
+
+// registerTagRoutes registers the per-tag post listings
+func registerTagRoutes(r *gin.Engine, db *sql.DB) {
+	r.GET("/tag/:name", func(c *gin.Context) {
+		tag := strings.ToLower(strings.TrimSpace(c.Param("name")))
+		page, perPage := parsePageParams(c)
+
+		opts := postListOptions{Sort: parseSort(c.Query("sort")), Tag: tag, Limit: perPage, Offset: (page - 1) * perPage}
+		total, err := countPosts(c.Request.Context(), db, opts)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		posts, err := listPosts(c.Request.Context(), db, opts)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		data := pageData(c, page, perPage, total)
+		data["Posts"] = posts
+		data["Sort"] = opts.Sort
+		data["Tag"] = tag
+		renderTemplate(c, "index.html", data)
+	})
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryTimeout is a middleware that puts a deadline on the request context
+// Handlers pass c.Request.Context() to every query, so a slow query or a
+// disconnected client releases its database connection instead of holding it.
+func queryTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
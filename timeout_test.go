@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	r := testRouter(nil)
+	r.Use(queryTimeout(timeout))
+
+	var deadline time.Time
+	var hasDeadline bool
+	var ctxErr error
+	r.GET("/slow", func(c *gin.Context) {
+		deadline, hasDeadline = c.Request.Context().Deadline()
+		// Stand in for a query that outlasts the timeout
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(time.Second):
+		}
+		ctxErr = c.Request.Context().Err()
+		c.Status(http.StatusOK)
+	})
+
+	start := time.Now()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	end := time.Now()
+	if !hasDeadline {
+		t.Fatal("request context has no deadline")
+	}
+	if deadline.Before(start.Add(timeout)) || deadline.After(end.Add(timeout)) {
+		t.Errorf("deadline %v after the request started, want %v", deadline.Sub(start), timeout)
+	}
+	if !errors.Is(ctxErr, context.DeadlineExceeded) {
+		t.Errorf("context error = %v, want %v", ctxErr, context.DeadlineExceeded)
+	}
+	if elapsed := end.Sub(start); elapsed >= time.Second {
+		t.Errorf("handler ran for %v, so the deadline did not cut it short", elapsed)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+)
+
+// withTx runs fn in a transaction, committing it if fn returns nil
+// The transaction is rolled back if fn returns an error or panics, in which
+// case the panic continues once the rollback is done.
+func withTx(ctx context.Context, db *sql.DB, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	errFailed := errors.New("second insert failed")
+
+	tests := []struct {
+		name      string
+		fn        func(tx *sql.Tx) error
+		wantErr   error
+		wantPanic bool
+		wantRows  int // Rows the function's inserts leave behind
+	}{
+		{"commit", func(tx *sql.Tx) error {
+			return testInsertPost(ctx, tx)
+		}, nil, false, 1},
+		{"error rolls back", func(tx *sql.Tx) error {
+			if err := testInsertPost(ctx, tx); err != nil {
+				return err
+			}
+			return errFailed
+		}, errFailed, false, 0},
+		{"panic rolls back and is passed on", func(tx *sql.Tx) error {
+			if err := testInsertPost(ctx, tx); err != nil {
+				return err
+			}
+			panic("boom")
+		}, nil, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := db.Exec("DELETE FROM posts"); err != nil {
+				t.Fatal(err)
+			}
+			var err error
+			panicked := func() (panicked bool) {
+				defer func() { panicked = recover() != nil }()
+				err = withTx(ctx, db, tt.fn)
+				return false
+			}()
+			if panicked != tt.wantPanic {
+				t.Errorf("panicked = %v, want %v", panicked, tt.wantPanic)
+			}
+			if err != tt.wantErr {
+				t.Errorf("withTx = %v, want %v", err, tt.wantErr)
+			}
+			var rows int
+			if err := db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&rows); err != nil {
+				t.Fatal(err)
+			}
+			if rows != tt.wantRows {
+				t.Errorf("%d rows after withTx, want %d", rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+// testInsertPost inserts a post that only survives if its transaction commits
+func testInsertPost(ctx context.Context, tx *sql.Tx) error {
+	_, err := insertPost(ctx, tx, "In a transaction", "", "", nil, nil, anonymousAuthor)
+	return err
+}
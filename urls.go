@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// siteBaseURL is the configured public URL of the site, without a trailing slash
+// It is empty when BASE_URL is unset, in which case each request's own scheme and host are used.
+var siteBaseURL string
+
+// baseURL returns the scheme and host that absolute links to the site should use
+func baseURL(c *gin.Context) string {
+	if siteBaseURL != "" {
+		return siteBaseURL
+	}
+	return requestBaseURL(c)
+}
+
+// requestBaseURL derives the scheme and host the client used to reach the site
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if isHTTPS(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// trustedProxies are the networks whose forwarding headers are believed
+// main sets it from TRUSTED_PROXIES.
+var trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses a list of IP addresses and CIDR ranges the way gin's SetTrustedProxies does
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, n, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// isHTTPS reports whether the client reached the site over https
+// Behind a TLS-terminating proxy the connection itself is plain http, so the
+// proxy's X-Forwarded-Proto header decides, but only when the request comes
+// straight from a trusted proxy; anyone else could send the header too.
+func isHTTPS(c *gin.Context) bool {
+	if c.Request.TLS != nil {
+		return true
+	}
+	proto := c.GetHeader("X-Forwarded-Proto")
+	if proto == "" {
+		return false
+	}
+	// Proxy chains may append their own value, and the first one is the client's
+	if i := strings.IndexByte(proto, ','); i >= 0 {
+		proto = proto[:i]
+	}
+	if !strings.EqualFold(strings.TrimSpace(proto), "https") {
+		return false
+	}
+	ip := net.ParseIP(c.RemoteIP())
+	for _, n := range trustedProxies {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// absURL turns a site path such as "/post/1/hello" into an absolute URL
+func absURL(c *gin.Context, path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return baseURL(c) + path
+}
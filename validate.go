@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxTitleLength matches the VARCHAR(255) title column
+const maxTitleLength = 255
+
+// fieldError describes a problem with a single submitted form field
+type fieldError struct {
+	Field   string
+	Message string
+}
+
+// fieldErrors is a list of validation problems in form order
+type fieldErrors []fieldError
+
+// Map returns the first message for each invalid field, keyed by field name
+// Forms get it as FieldErrors and show each message next to its field; it is
+// nil when there are no errors.
+func (errs fieldErrors) Map() map[string]string {
+	if len(errs) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(errs))
+	for _, e := range errs {
+		if _, ok := m[e.Field]; !ok {
+			m[e.Field] = e.Message
+		}
+	}
+	return m
+}
+
+// validatePost checks the title, link and content of a submitted post
+// The title is expected to be trimmed already. Link posts may leave the content
+// empty and text posts the link, but one of them is required. The link itself
+// is checked by validateLink. It returns nil if the post is valid.
+func validatePost(title, link, content string) fieldErrors {
+	var errs fieldErrors
+	if title == "" {
+		errs = append(errs, fieldError{"title", "Title is required"})
+	} else if utf8.RuneCountInString(title) > maxTitleLength {
+		errs = append(errs, fieldError{"title", fmt.Sprintf("Title must be at most %d characters", maxTitleLength)})
+	}
+	if strings.TrimSpace(link) == "" && strings.TrimSpace(content) == "" {
+		errs = append(errs, fieldError{"content", "Add a link or some text"})
+	}
+	return errs
+}
+
+// checkSubmission runs every check of a new post from the form or the JSON API
+// It validates the post, its link and its comma-separated tags, then rejects
+// likely spam once everything else passed. It returns the normalized link and
+// the parsed tags, with errs nil if the post may be submitted.
+func checkSubmission(title, link, content, tags string) (string, []string, fieldErrors) {
+	errs := validatePost(title, link, content)
+	link, err := validateLink(link)
+	if err != nil {
+		errs = append(errs, fieldError{"link", err.Error()})
+	}
+	parsed, err := parseTags(tags)
+	if err != nil {
+		errs = append(errs, fieldError{"tags", err.Error()})
+	}
+	if errs == nil && isLikelySpam(title, content) {
+		errs = append(errs, fieldError{"content", "This post looks like spam. Please remove excess links, all-caps text or promotional phrases."})
+	}
+	return link, parsed, errs
+}
+
+// validateComment checks the content of a submitted comment
+// It returns nil if the comment is valid.
+func validateComment(content string) fieldErrors {
+	if strings.TrimSpace(content) == "" {
+		return fieldErrors{{"content", "Comment can't be empty"}}
+	}
+	return nil
+}
+
+// cleanTitle turns text from outside the form, such as a page title passed by
+// the bookmarklet, into a usable post title
+// Control characters are removed, whitespace is collapsed and the result is
+// cut to maxTitleLength characters.
+func cleanTitle(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	runes := []rune(strings.Join(strings.Fields(s), " "))
+	if len(runes) > maxTitleLength {
+		runes = runes[:maxTitleLength]
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// maxLinkLength matches the VARCHAR(255) link column
+const maxLinkLength = 255
+
+// validateLink checks a submitted post link and returns it in normalized form
+// An empty link is allowed for text-only posts. Otherwise the link must be an
+// absolute http or https URL with a host, at most maxLinkLength characters
+// long once normalized.
+func validateLink(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return "", nil
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", errors.New("link is not a valid URL")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New("link must start with http:// or https://")
+	}
+	if u.Host == "" {
+		return "", errors.New("link must include a host, e.g. https://example.com")
+	}
+	u.Host = strings.ToLower(u.Host)
+	if link = u.String(); utf8.RuneCountInString(link) > maxLinkLength {
+		return "", fmt.Errorf("link must be at most %d characters", maxLinkLength)
+	}
+	return link, nil
+}
+
+// maxEmailLength matches the VARCHAR(255) email column
+const maxEmailLength = 255
+
+// validEmail reports whether s is a bare email address without a display name
+func validEmail(s string) bool {
+	if len(s) > maxEmailLength {
+		return false
+	}
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
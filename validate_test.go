@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePost(t *testing.T) {
+	tests := []struct {
+		name                 string
+		title, link, content string
+		wantErr              map[string]bool
+	}{
+		{"valid", "Show HN: a thing", "https://example.com", "", nil},
+		{"title required", "", "https://example.com", "", map[string]bool{"title": true}},
+		{"longest title", strings.Repeat("é", maxTitleLength), "https://example.com", "", nil},
+		{"title too long", strings.Repeat("a", maxTitleLength+1), "https://example.com", "", map[string]bool{"title": true}},
+		{"text post", "Ask HN: why?", "", "Just wondering", nil},
+		{"link and text", "Both", "https://example.com", "Some context", nil},
+		{"neither link nor text", "Empty", "", "", map[string]bool{"content": true}},
+		{"only whitespace", "Blank", "  ", "\n\t", map[string]bool{"content": true}},
+		{"every field wrong", "", "", "", map[string]bool{"title": true, "content": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validatePost(tt.title, tt.link, tt.content)
+			got := errs.Map()
+			if len(got) != len(tt.wantErr) {
+				t.Fatalf("validatePost errors = %v, want errors on %v", got, tt.wantErr)
+			}
+			for field := range tt.wantErr {
+				if got[field] == "" {
+					t.Errorf("no error on %s, got %v", field, got)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		link    string
+		want    string
+		wantErr bool
+	}{
+		{"empty for text posts", "", "", false},
+		{"only spaces", "   ", "", false},
+		{"kept as is", "https://example.com/a?b=c", "https://example.com/a?b=c", false},
+		{"trimmed", "  https://example.com/  ", "https://example.com/", false},
+		{"scheme and host lowercased", "HTTP://Example.COM/Path", "http://example.com/Path", false},
+		{"no scheme", "example.com/a", "", true},
+		{"other scheme", "javascript:alert(1)", "", true},
+		{"ftp", "ftp://example.com/file", "", true},
+		{"no host", "https:///path", "", true},
+		{"unparsable", "https://exa mple.com/%zz", "", true},
+		{"longest allowed", "https://example.com/" + strings.Repeat("a", maxLinkLength-20), "https://example.com/" + strings.Repeat("a", maxLinkLength-20), false},
+		{"too long", "https://example.com/" + strings.Repeat("a", maxLinkLength-19), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateLink(tt.link)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateLink(%q) error = %v, want error %v", tt.link, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("validateLink(%q) = %q, want %q", tt.link, got, tt.want)
+			}
+		})
+	}
+}
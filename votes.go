@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	voteUp   = 1
+	voteDown = -1
+)
+
+// voterKey identifies who is voting: the user when logged in, otherwise the client IP
+func voterKey(c *gin.Context) string {
+	if id := currentUserID(c); id != nil {
+		return "user:" + strconv.Itoa(*id)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// castVote records a vote by voter on a post and returns the post's new points
+// Each voter holds one vote per post: repeating it is a no-op and voting the
+// other way flips it. Points are recomputed as the sum of all votes, but never
+// drop below floor. The change in points is added to the author's karma.
+// It returns sql.ErrNoRows if the post does not exist.
+func castVote(ctx context.Context, db *sql.DB, postID int, voter string, value, floor int) (int, error) {
+	var points int
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		var oldPoints int
+		var authorID sql.NullInt64
+		if err := tx.QueryRowContext(ctx, "SELECT points, author_id FROM posts WHERE id = $1 AND deleted_at IS NULL", postID).Scan(&oldPoints, &authorID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+            INSERT INTO votes (post_id, voter, value, created_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+            ON CONFLICT (post_id, voter) DO UPDATE SET value = excluded.value
+        `, postID, voter, value); err != nil {
+			return err
+		}
+
+		if err := tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(value), 0) FROM votes WHERE post_id = $1", postID).Scan(&points); err != nil {
+			return err
+		}
+		if points < floor {
+			points = floor
+		}
+		// The hot score is refreshed here too so a vote moves the post without waiting for the worker
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET points = $1 WHERE id = $2", points, postID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET hot_score = "+hotScoreExpr(db)+" WHERE id = $1", postID); err != nil {
+			return err
+		}
+		if authorID.Valid && points != oldPoints {
+			if _, err := tx.ExecContext(ctx, "UPDATE users SET karma = karma + $1 WHERE id = $2", points-oldPoints, authorID.Int64); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return points, nil
+}
+
+// registerVoteRoutes registers the upvote and downvote routes
+// Browser forms are redirected back to the page they came from, while clients
+// asking for JSON get the post's new points.
+func registerVoteRoutes(r *gin.Engine, db *sql.DB, floor int) {
+	vote := func(value int) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			postID, err := strconv.Atoi(c.Param("id"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+				return
+			}
+			points, err := castVote(c.Request.Context(), db, postID, voterKey(c), value, floor)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+				} else {
+					serverError(c, err)
+				}
+				return
+			}
+			if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+				c.JSON(http.StatusOK, gin.H{"points": points})
+				return
+			}
+			// Redirect back to the page the vote came from
+			back := c.Request.Referer()
+			if back == "" {
+				back = "/"
+			}
+			c.Redirect(http.StatusFound, back)
+		}
+	}
+
+	// Route to upvote a post
+	r.POST("/post/:id/upvote", vote(voteUp))
+
+	// Route to downvote a post
+	r.POST("/post/:id/downvote", vote(voteDown))
+}
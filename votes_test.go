@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestCastVote(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	author := testUser(t, db, "author")
+	post := testPost(t, db, "Votable", "", &author)
+	const floor = -1
+
+	// Each step runs on the state left by the previous ones
+	steps := []struct {
+		name       string
+		voter      string
+		value      int
+		wantPoints int
+		// wantKarma follows the points, including the floor
+		wantKarma int
+	}{
+		{"first upvote", "user:1", voteUp, 1, 1},
+		{"repeated upvote is a no-op", "user:1", voteUp, 1, 1},
+		{"flipping to a downvote moves points by 2", "user:1", voteDown, -1, -1},
+		{"repeated downvote is a no-op", "user:1", voteDown, -1, -1},
+		{"points stop at the floor", "ip:10.0.0.1", voteDown, floor, floor},
+		{"an upvote from below the floor counts from the sum", "ip:10.0.0.2", voteUp, floor, floor},
+		{"flipping back to an upvote", "user:1", voteUp, 1, 1},
+	}
+	for _, step := range steps {
+		points, err := castVote(ctx, db, post, step.voter, step.value, floor)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if points != step.wantPoints {
+			t.Errorf("%s: castVote returned %d points, want %d", step.name, points, step.wantPoints)
+		}
+		stored, err := getPostByID(ctx, db, post)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Points != step.wantPoints {
+			t.Errorf("%s: post has %d points, want %d", step.name, stored.Points, step.wantPoints)
+		}
+		if karma := testKarma(t, db, author); karma != step.wantKarma {
+			t.Errorf("%s: author has %d karma, want %d", step.name, karma, step.wantKarma)
+		}
+	}
+
+	if _, err := castVote(ctx, db, post+1, "user:1", voteUp, floor); err != sql.ErrNoRows {
+		t.Errorf("vote on a missing post: %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestSetPostDeletedKarma(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	author := testUser(t, db, "author")
+	kept := testPost(t, db, "Kept", "", &author)
+	removed := testPost(t, db, "Removed", "", &author)
+	for i, voter := range []string{"ip:10.0.0.1", "ip:10.0.0.2", "ip:10.0.0.3"} {
+		post := kept
+		if i > 0 {
+			post = removed
+		}
+		if _, err := castVote(ctx, db, post, voter, voteUp, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name      string
+		run       func() error
+		wantErr   error
+		wantKarma int
+	}{
+		{"votes on both posts", func() error { return nil }, nil, 3},
+		{"deleting takes the post's points out", func() error { return deletePost(ctx, db, removed) }, nil, 1},
+		{"deleting twice changes nothing", func() error { return deletePost(ctx, db, removed) }, sql.ErrNoRows, 1},
+		{"restoring puts them back", func() error { return restorePost(ctx, db, removed) }, nil, 3},
+		{"restoring a live post changes nothing", func() error { return restorePost(ctx, db, kept) }, sql.ErrNoRows, 3},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != step.wantErr {
+			t.Fatalf("%s: %v, want %v", step.name, err, step.wantErr)
+		}
+		if karma := testKarma(t, db, author); karma != step.wantKarma {
+			t.Errorf("%s: author has %d karma, want %d", step.name, karma, step.wantKarma)
+		}
+	}
+}
+
+// testKarma returns the stored karma of a user
+func testKarma(t *testing.T, db *sql.DB, userID int) int {
+	t.Helper()
+	var karma int
+	if err := db.QueryRow("SELECT karma FROM users WHERE id = $1", userID).Scan(&karma); err != nil {
+		t.Fatal(err)
+	}
+	return karma
+}